@@ -1,19 +1,26 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
 	"text/template"
 
 	"github.com/fatih/color"
 	"github.com/tj/robo/config"
+	"github.com/tj/robo/interpolation"
 	"github.com/tj/robo/task"
 )
 
 // Template helpers.
 var helpers = template.FuncMap{
+	"origin":  origin,
+	"workdir": workdir,
+	"join":    strings.Join,
 	"magenta": color.MagentaString,
 	"yellow":  color.YellowString,
 	"green":   color.GreenString,
@@ -26,7 +33,9 @@ var helpers = template.FuncMap{
 
 // List template.
 var list = `
-{{range .Tasks}}  {{cyan .Name}} – {{.Summary}}
+{{with .Profile}}  {{cyan "Profile:"}} {{.}}
+
+{{end}}{{range .Tasks}}  {{cyan .Name}} – {{.Summary}}{{if ne .File $.File}} {{origin .File}}{{end}}
 {{end}}
 `
 
@@ -36,7 +45,7 @@ var quiet = "{{range .Tasks}}{{ .Name }}\n{{end}}"
 // Variables template.
 var variables = `
 {{- range $k, $v := . }}
-{{cyan "%s" $k }}: {{$v}}
+{{cyan "%s" $k }}: {{$v}}{{if overridden $k}} {{yellow "(overridden)"}}{{end}}
 {{- end }}
 `
 
@@ -49,7 +58,28 @@ var help = `
   {{cyan "Description:"}}
 
     {{.Summary}}
-{{with .Examples}}
+
+  {{cyan "Directory:"}}
+
+    {{workdir .}}
+{{with .Params}}
+  {{cyan "Parameters:"}}
+{{range .}}
+    {{.Name}} ({{.Type}}{{if .Required}}, required{{end}}){{with .Description}} – {{.}}{{end}}
+{{- with .Default}} [default: {{.}}]{{end}}
+{{- with .Enum}} [one of: {{join . ", "}}]{{end}}
+{{- end}}
+{{end}}{{with .Flags}}
+  {{cyan "Flags:"}}
+{{range .}}
+    {{if or .Help .Default}}{{printf "%-24s" .String}} {{.Help}}{{else}}{{.String}}{{end}}
+{{- with .Default}} [default: {{.}}]{{end}}
+{{- end}}
+{{end}}{{with .Deps}}
+  {{cyan "Dependencies:"}}
+
+    {{range .}}{{.}} {{end}}
+{{end}}{{with .Examples}}
   {{cyan "Examples:"}}
   {{range .}}
     {{.Description}}
@@ -59,13 +89,24 @@ var help = `
 
 // ListVariables outputs the variables defined.
 func ListVariables(c *config.Config) {
-	tmpl := t(variables)
+	s := variables
 
 	if c.Templates.Variables != "" {
-		tmpl = t(c.Templates.Variables)
+		s = c.Templates.Variables
 	}
 
-	flattened := flatten("", reflect.ValueOf(c.Variables))
+	tmpl := template.Must(template.New("").Funcs(helpers).Funcs(template.FuncMap{
+		"overridden": func(key string) bool {
+			for _, k := range c.Overridden {
+				if "."+k == key {
+					return true
+				}
+			}
+			return false
+		},
+	}).Parse(s))
+
+	flattened := flatten("", reflect.ValueOf(c.ListedVariables()))
 	tmpl.Execute(os.Stdout, flattened)
 }
 
@@ -94,6 +135,21 @@ func Help(c *config.Config, name string) {
 		Fatalf("undefined task %q", name)
 	}
 
+	if task.Usage == "" && (len(task.Params) > 0 || len(task.Flags) > 0) {
+		cp := *task
+		cp.Usage = task.ParamsUsage()
+		task = &cp
+	}
+
+	// the dir of tasks with parameters or flags is interpolated once they are run.
+	if task.Vars != nil {
+		cp := *task
+		if err := interpolation.Strings("dir", interpolation.Placeholders(task.Vars, task), &cp.Dir); err != nil {
+			Fatalf("error interpolating dir: %s", err)
+		}
+		task = &cp
+	}
+
 	tmpl := t(help)
 
 	if c.Templates.Help != "" {
@@ -103,41 +159,300 @@ func Help(c *config.Config, name string) {
 	tmpl.Execute(os.Stdout, task)
 }
 
-// Run the task.
-func Run(c *config.Config, name string, args []string) {
+// Env outputs the environment the task runs with.
+func Env(c *config.Config, name string, args []string) {
 	t, ok := c.Tasks[name]
 	if !ok {
 		Fatalf("undefined task %q", name)
 	}
-	lookupPath := filepath.Dir(c.File)
-	t.LookupPath = lookupPath
+
+	t, _, err := prepare(c, t, args)
+	if err != nil {
+		Fatalf("%s", err)
+	}
+
+	for _, kv := range t.Environ() {
+		fmt.Println(kv)
+	}
+}
+
+// Options for running tasks.
+type Options struct {
+	// Jobs is the number of tasks run in parallel.
+	Jobs int
+
+	// Output is the output mode, one of Interleaved, Prefixed or Grouped.
+	Output string
+
+	// Force runs tasks even when they are up to date.
+	Force bool
+
+	// Verbose explains why tasks are skipped.
+	Verbose bool
+}
+
+// Run the task and its dependencies.
+func Run(c *config.Config, name string, args []string, o Options) {
+	t, args, out := setup(c, name, args, o)
+
+	if errs := run(context.Background(), c, t, args, o, out); len(errs) > 0 {
+		Exitf(exitCode(t.Name, errs), "error(s): \n%s", listErrors(errs))
+	}
+}
+
+// exitCode returns the exit code robo exits with when the task `name`
+// failed with `errs`. The exit code of the task's own command takes
+// precedence over the ones of failed steps and dependencies, otherwise
+// the first error determines the exit code.
+func exitCode(name string, errs []error) int {
+	return task.ExitCode(task.Cause(name, errs))
+}
+
+// setup returns the prepared task `name`, its remaining
+// arguments and the output, exiting on error.
+func setup(c *config.Config, name string, args []string, o Options) (*task.Task, []string, *output) {
+	t, ok := c.Tasks[name]
+	if !ok {
+		Fatalf("undefined task %q", name)
+	}
+
+	t, args, err := prepare(c, t, args)
+	if err != nil {
+		Fatalf("%s", err)
+	}
+
+	out, err := newOutput(o.Output, order(c, name))
+	if err != nil {
+		Fatalf("%s", err)
+	}
+
+	return t, args, out
+}
+
+// run the task `t` and its dependencies between the global steps. The global
+// steps of the included files whose tasks run are run once, between the ones
+// of the including files.
+func run(ctx context.Context, c *config.Config, t *task.Task, args []string, o Options, out *output) []error {
+	global := stepOptions(c, args, nil, o)
+	names := order(c, t.Name)
+	nss := namespaces(c, names, args, o)
 
 	var errs []error
-	if err := task.RunOptionals("before", "GLOBAL", c.Before, args, lookupPath, nil); err != nil {
+	if err := task.RunOptionalsContext(ctx, "before", "GLOBAL", c.Before, global); err != nil {
 		errs = append(errs, err)
 	}
 
-	if runErrs := t.Run(args); len(runErrs) > 0 {
+	for _, ns := range nss {
+		if err := task.RunOptionalsContext(ctx, "before", ns.name, ns.c.Before, ns.o); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if runErrs := runDeps(ctx, c, t, args, o, out); len(runErrs) > 0 {
 		errs = append(errs, runErrs...)
 	}
 
-	if err := task.RunOptionals("after", "GLOBAL", c.After, args, lookupPath, nil); err != nil {
+	for i := len(nss) - 1; i >= 0; i-- {
+		ns := nss[i]
+		if err := task.RunOptionalsContext(ctx, "after", ns.name, ns.c.After, ns.o); err != nil {
+			errs = append(errs, err)
+		}
+		errs = append(errs, task.RunHooksContext(ctx, ns.name, ns.c.OnSuccess, ns.c.OnFailure, ns.c.Finally, cause(t.Name, errs), ns.o)...)
+	}
+
+	if err := task.RunOptionalsContext(ctx, "after", "GLOBAL", c.After, global); err != nil {
 		errs = append(errs, err)
 	}
 
-	if len(errs) > 0 {
-		var msg string
-		for _, err := range errs {
-			msg += fmt.Sprintf("    - %+v\n", err)
+	return append(errs, task.RunHooksContext(ctx, "GLOBAL", c.OnSuccess, c.OnFailure, c.Finally, cause(t.Name, errs), global)...)
+}
+
+// cause returns the error causing the task `name` to fail, if any.
+func cause(name string, errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return task.Cause(name, errs)
+}
+
+// stepOptions returns the options the global steps of `c` run with,
+// its env is added to `env`.
+func stepOptions(c *config.Config, args []string, env []string, o Options) task.Options {
+	env = append(append(append([]string(nil), env...), c.FileEnv...), c.Env...)
+	return task.Options{
+		LookupPath: filepath.Dir(c.File),
+		Args:       args,
+		Env:        env,
+		Dir:        task.ResolveDir(filepath.Dir(c.File), c.Dir),
+		Shell:      c.Shell,
+		Inherit:    c.EnvInherit,
+		Stdin:      os.Stdin,
+		Stdout:     os.Stdout,
+		Stderr:     os.Stderr,
+		RunTask:    runTask(c, o),
+	}
+}
+
+// namespace is an included configuration whose global steps run.
+type namespace struct {
+	name string
+	c    *config.Config
+	o    task.Options
+}
+
+// namespaces returns the included configurations of the tasks `names`, the
+// including ones first. Their global steps refer to the tasks of the root
+// configuration `c` and run with the env of the including configurations.
+func namespaces(c *config.Config, names []string, args []string, o Options) []namespace {
+	included := c.Namespaces()
+
+	used := make(map[string]bool)
+	for _, name := range names {
+		parts := strings.Split(name, ":")
+		for i := 1; i < len(parts); i++ {
+			if ns := strings.Join(parts[:i], ":"); included[ns] != nil {
+				used[ns] = true
+			}
 		}
-		Fatalf("error(s): \n%s", msg)
+	}
+
+	var nss []string
+	for ns := range used {
+		nss = append(nss, ns)
+	}
+	sort.Strings(nss)
+
+	var ret []namespace
+	for _, ns := range nss {
+		env := append(append([]string(nil), c.FileEnv...), c.Env...)
+		parts := strings.Split(ns, ":")
+		for i := 1; i < len(parts); i++ {
+			if inc := included[strings.Join(parts[:i], ":")]; inc != nil {
+				env = append(append(env, inc.FileEnv...), inc.Env...)
+			}
+		}
+
+		so := stepOptions(included[ns], args, env, o)
+		so.RunTask = runTask(c, o)
+		ret = append(ret, namespace{ns, included[ns], so})
+	}
+
+	return ret
+}
+
+// listErrors formats `errs` as a list.
+func listErrors(errs []error) string {
+	var msg string
+	for _, err := range errs {
+		msg += fmt.Sprintf("    - %+v\n", err)
+	}
+	return msg
+}
+
+// prepare returns a copy of the task `t` with its flags and parameters
+// parsed from `args`, interpolated along with its variables and added
+// to its environment. The arguments which are not flags are returned.
+func prepare(c *config.Config, t *task.Task, args []string) (*task.Task, []string, error) {
+	if len(t.Params) == 0 && len(t.Flags) == 0 {
+		return t, args, nil
+	}
+
+	flags, args, err := t.ParseFlags(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params, err := t.ParseParams(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vars := t.Vars
+	if vars == nil {
+		vars = c.Variables
+	}
+
+	t = t.Clone()
+	data := interpolation.With(vars, "params", params)
+	data = interpolation.With(data, "flags", flags)
+	if err := interpolation.Task(t, data); err != nil {
+		return nil, nil, err
+	}
+
+	t.Env = append(t.Env, task.ParamsEnv(task.FlagPrefix, flags)...)
+	t.Env = append(t.Env, task.ParamsEnv(task.ParamPrefix, params)...)
+	return t, args, nil
+}
+
+// runTask returns a function running the tasks of c referenced by steps. The
+// referenced task writes to the output of the step, its dependencies aren't run.
+func runTask(c *config.Config, o Options) task.RunTaskFunc {
+	return func(ctx context.Context, name string, args []string, to task.Options) error {
+		t, ok := c.Tasks[name]
+		if !ok {
+			return fmt.Errorf("undefined task %q", name)
+		}
+
+		t, args, err := prepare(c, t, args)
+		if err != nil {
+			return err
+		}
+
+		// the step continues once the referenced task is done,
+		// its exec can't replace the current process.
+		cp := *t
+		t = &cp
+		t.Stdout = to.Stdout
+		t.Stderr = to.Stderr
+		t.Force = o.Force
+		t.Verbose = o.Verbose
+		t.Spawn = true
+		t.RunTask = to.RunTask
+		if t.LookupPath == "" {
+			t.LookupPath = filepath.Dir(c.File)
+		}
+
+		if errs := t.RunContext(ctx, args); len(errs) > 0 {
+			return task.Cause(name, errs)
+		}
+		return nil
 	}
 }
 
 // Fatalf writes to stderr and exits.
 func Fatalf(msg string, args ...interface{}) {
+	Exitf(1, msg, args...)
+}
+
+// Exitf writes to stderr and exits with `code`.
+func Exitf(code int, msg string, args ...interface{}) {
 	fmt.Fprintf(os.Stderr, "\n  %s\n\n", fmt.Sprintf(msg, args...))
-	os.Exit(1)
+	os.Exit(code)
+}
+
+// origin returns a short description of where `file` is located,
+// relative to the working directory or the home directory.
+func origin(file string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, file); err == nil && !strings.HasPrefix(rel, "..") {
+			return "(" + rel + ")"
+		}
+	}
+
+	if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(file, home+"/") {
+		return "(~" + strings.TrimPrefix(file, home) + ")"
+	}
+
+	return "(" + file + ")"
+}
+
+// workdir returns the absolute directory the task `t` runs in.
+func workdir(t *task.Task) string {
+	dir, err := filepath.Abs(t.WorkDir())
+	if err != nil {
+		return t.WorkDir()
+	}
+	return dir
 }
 
 // Template helper.
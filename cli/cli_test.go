@@ -1,16 +1,25 @@
 package cli
 
 import (
-	"github.com/bmizerany/assert"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sync"
 	"testing"
+
+	"github.com/bmizerany/assert"
+	"github.com/tj/robo/config"
+	"github.com/tj/robo/task"
 )
 
 func TestFlatten(t *testing.T) {
 	vars := map[string]interface{}{
 		"root": "foo",
-		"one":
-		map[interface{}]interface{}{
+		"one": map[interface{}]interface{}{
 			"two": "bar",
 			"three": map[interface{}]interface{}{
 				"hello": "world",
@@ -24,4 +33,172 @@ func TestFlatten(t *testing.T) {
 	assert.Equal(t, "foo", flattened[".root"])
 	assert.Equal(t, "bar", flattened[".one.two"])
 	assert.Equal(t, "world", flattened[".one.three.hello"])
-}
\ No newline at end of file
+}
+
+func TestWorkdir(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, wd, workdir(&task.Task{}))
+	assert.Equal(t, filepath.Join(wd, "web"), workdir(&task.Task{Dir: "web"}))
+	assert.Equal(t, "/srv/web", workdir(&task.Task{LookupPath: "/srv", Dir: "web"}))
+}
+
+func TestOrder(t *testing.T) {
+	c, err := config.NewString(`
+build:
+  command: echo build
+test:
+  deps: [build]
+  command: echo test
+lint:
+  command: echo lint
+deploy:
+  deps: [test, lint, build]
+  command: echo deploy
+`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"build", "test", "lint", "deploy"}, order(c, "deploy"))
+	assert.Equal(t, []string{"build", "test"}, order(c, "test"))
+}
+
+func TestRunDeps(t *testing.T) {
+	c, err := config.NewString(`
+fail:
+  command: exit 1
+ok:
+  command: "true"
+after-fail:
+  deps: [fail, ok]
+  command: "true"
+`)
+	assert.Equal(t, nil, err)
+
+	out, err := newOutput(Grouped, order(c, "after-fail"))
+	assert.Equal(t, nil, err)
+
+	errs := runDeps(context.Background(), c, c.Tasks["after-fail"], nil, Options{Jobs: 2}, out)
+	assert.Equal(t, 2, len(errs))
+	assert.Equal(t, "task 'after-fail' skipped, dependency 'fail' failed", errs[1].Error())
+}
+
+func TestRunDeps_exec(t *testing.T) {
+	c, err := config.NewString(`
+fail:
+  exec: "false"
+check:
+  deps: [fail]
+  command: "true"
+`)
+	assert.Equal(t, nil, err)
+
+	out, err := newOutput(Interleaved, order(c, "check"))
+	assert.Equal(t, nil, err)
+
+	// the exec runs as a child process instead of replacing the test.
+	errs := runDeps(context.Background(), c, c.Tasks["check"], nil, Options{Jobs: 1}, out)
+	assert.Equal(t, 2, len(errs))
+	assert.Equal(t, "task 'check' skipped, dependency 'fail' failed", errs[1].Error())
+}
+
+func TestRun_taskExec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "robo")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	log := filepath.Join(dir, "log")
+	c, err := config.NewString(fmt.Sprintf(`
+child:
+  exec: "false"
+parent:
+  before:
+    - task: child
+  command: echo main >> %[1]s
+  after:
+    - command: echo after >> %[1]s
+`, log))
+	assert.Equal(t, nil, err)
+
+	out, err := newOutput(Interleaved, order(c, "parent"))
+	assert.Equal(t, nil, err)
+
+	// the exec runs as a child process instead of replacing the test.
+	errs := run(context.Background(), c, c.Tasks["parent"], nil, Options{Jobs: 1}, out)
+	assert.Equal(t, 1, len(errs))
+
+	b, err := ioutil.ReadFile(log)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "main\nafter\n", string(b))
+}
+
+func TestRun_included(t *testing.T) {
+	dir, err := ioutil.TempDir("", "robo")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "robo.yml")
+	err = ioutil.WriteFile(root, []byte(`
+include:
+  api: api.yml
+
+all:
+  deps: [api:build, api:test]
+`), 0644)
+	assert.Equal(t, nil, err)
+
+	log := filepath.Join(dir, "log")
+	err = ioutil.WriteFile(filepath.Join(dir, "api.yml"), []byte(fmt.Sprintf(`
+before:
+  - command: echo before >> %[1]s
+after:
+  - command: echo after >> %[1]s
+build:
+  command: echo build >> %[1]s
+test:
+  command: echo test >> %[1]s
+`, log)), 0644)
+	assert.Equal(t, nil, err)
+
+	c, err := config.New(root)
+	assert.Equal(t, nil, err)
+
+	out, err := newOutput(Interleaved, order(c, "all"))
+	assert.Equal(t, nil, err)
+
+	errs := run(context.Background(), c, c.Tasks["all"], nil, Options{Jobs: 1}, out)
+	assert.Equal(t, 0, len(errs))
+
+	b, err := ioutil.ReadFile(log)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "before\nbuild\ntest\nafter\n", string(b))
+}
+
+func TestLineWriter(t *testing.T) {
+	var mu sync.Mutex
+	var b bytes.Buffer
+	w := &lineWriter{mu: &mu, w: &b, prefix: "foo | "}
+
+	fmt.Fprint(w, "one\ntw")
+	assert.Equal(t, "foo | one\n", b.String())
+
+	fmt.Fprint(w, "o\nthree")
+	assert.Equal(t, "foo | one\nfoo | two\n", b.String())
+
+	w.flush()
+	assert.Equal(t, "foo | one\nfoo | two\nfoo | three\n", b.String())
+}
+
+func TestExitCode(t *testing.T) {
+	exit := func(code int) error {
+		r := &task.Runnable{Command: fmt.Sprintf("exit %d", code)}
+		return r.RunContext(context.Background(), task.Options{})
+	}
+
+	before := &task.Error{Task: "deploy", Step: "before", Index: 1, Err: exit(4)}
+	main := &task.Error{Task: "deploy", Err: exit(5)}
+	dep := &task.Error{Task: "build", Err: exit(6)}
+
+	assert.Equal(t, 5, exitCode("deploy", []error{before, main}))
+	assert.Equal(t, 4, exitCode("deploy", []error{before, dep}))
+	assert.Equal(t, 6, exitCode("deploy", []error{dep, fmt.Errorf("task 'deploy' skipped")}))
+}
@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/tj/robo/config"
+	"github.com/tj/robo/task"
+)
+
+// order returns the tasks `name` depends on, directly or transitively,
+// followed by `name` itself. Every task appears exactly once and always
+// after its own dependencies.
+func order(c *config.Config, name string) []string {
+	var names []string
+	seen := make(map[string]bool)
+
+	var visit func(name string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+
+		for _, dep := range c.Tasks[name].Deps {
+			visit(dep)
+		}
+
+		names = append(names, name)
+	}
+
+	visit(name)
+	return names
+}
+
+// runDeps runs the `root` task with `args` after its dependencies.
+// Dependencies are invoked once and without arguments, taking the
+// default values of their parameters and flags. A failing dependency
+// prevents its dependents from running. The exec steps of dependencies
+// run as child processes instead of replacing robo. Up to `jobs` tasks
+// whose dependencies are satisfied run in parallel and write to `out`.
+func runDeps(ctx context.Context, c *config.Config, root *task.Task, args []string, o Options, out *output) []error {
+	type result struct {
+		name string
+		errs []error
+	}
+
+	jobs := o.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	pending := order(c, root.Name)
+
+	// interactive tasks keep the terminal when run one at a time.
+	direct := jobs == 1 && out.mode == Interleaved
+
+	var errs []error
+	done := make(map[string]bool)
+	failed := make(map[string]bool)
+	results := make(chan result)
+	running := 0
+
+	for len(pending) > 0 || running > 0 {
+		for i := 0; i < len(pending) && running < jobs && ctx.Err() == nil; {
+			n := pending[i]
+			t := *c.Tasks[n]
+			if n == root.Name {
+				t = *root
+			}
+
+			if dep := failedDep(t.Deps, failed); dep != "" {
+				pending = append(pending[:i], pending[i+1:]...)
+				done[n] = true
+				failed[n] = true
+				errs = append(errs, fmt.Errorf("task '%s' skipped, dependency '%s' failed", n, dep))
+				continue
+			}
+
+			if !allDone(t.Deps, done) {
+				i++
+				continue
+			}
+
+			pending = append(pending[:i], pending[i+1:]...)
+
+			var targs []string
+			if n == root.Name {
+				targs = args
+			} else if t.Vars != nil {
+				prepared, _, err := prepare(c, &t, nil)
+				if err != nil {
+					done[n] = true
+					failed[n] = true
+					errs = append(errs, &task.Error{Task: n, Err: err})
+					continue
+				}
+				t = *prepared
+			}
+
+			running++
+
+			t.Force = o.Force
+			t.Verbose = o.Verbose
+			t.Spawn = n != root.Name
+			t.RunTask = runTask(c, o)
+			if t.LookupPath == "" {
+				t.LookupPath = filepath.Dir(c.File)
+			}
+
+			go func() {
+				if direct {
+					results <- result{t.Name, t.RunContext(ctx, targs)}
+					return
+				}
+
+				var flush func()
+				t.Stdout, t.Stderr, flush = out.writers(t.Name)
+				errs := t.RunContext(ctx, targs)
+				flush()
+				results <- result{t.Name, errs}
+			}()
+		}
+
+		if running == 0 {
+			break
+		}
+
+		res := <-results
+		running--
+		done[res.name] = true
+
+		if len(res.errs) > 0 {
+			failed[res.name] = true
+			errs = append(errs, res.errs...)
+		}
+	}
+
+	return errs
+}
+
+// allDone returns true when all of `deps` are done.
+func allDone(deps []string, done map[string]bool) bool {
+	for _, dep := range deps {
+		if !done[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+// failedDep returns the first of `deps` which failed.
+func failedDep(deps []string, failed map[string]bool) string {
+	for _, dep := range deps {
+		if failed[dep] {
+			return dep
+		}
+	}
+	return ""
+}
@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// Output modes.
+const (
+	// Interleaved writes the lines of all tasks as they are produced.
+	Interleaved = "interleaved"
+
+	// Prefixed writes lines as they are produced, prefixed with the task name.
+	Prefixed = "prefixed"
+
+	// Grouped buffers the output of each task until the task is done.
+	Grouped = "grouped"
+)
+
+// Colors used to tell prefixed tasks apart.
+var colors = []func(string, ...interface{}) string{
+	color.CyanString,
+	color.MagentaString,
+	color.YellowString,
+	color.GreenString,
+	color.BlueString,
+	color.RedString,
+}
+
+// output hands out writers to concurrently running tasks.
+type output struct {
+	mode  string
+	width int
+	tasks int
+	mu    sync.Mutex
+}
+
+// newOutput returns an output for the given mode and task names.
+func newOutput(mode string, names []string) (*output, error) {
+	switch mode {
+	case "":
+		mode = Interleaved
+	case Interleaved, Prefixed, Grouped:
+	default:
+		return nil, fmt.Errorf("unknown output mode %q", mode)
+	}
+
+	o := &output{mode: mode}
+	for _, name := range names {
+		if len(name) > o.width {
+			o.width = len(name)
+		}
+	}
+
+	return o, nil
+}
+
+// writers returns the stdout and stderr writers for the task `name`,
+// flush must be called once the task is done.
+func (o *output) writers(name string) (stdout, stderr io.Writer, flush func()) {
+	o.mu.Lock()
+	var prefix string
+	if o.mode == Prefixed {
+		c := colors[o.tasks%len(colors)]
+		prefix = c("%-*s", o.width, name) + " | "
+	}
+	o.tasks++
+	o.mu.Unlock()
+
+	out := &lineWriter{mu: &o.mu, w: os.Stdout, prefix: prefix, hold: o.mode == Grouped}
+	err := &lineWriter{mu: &o.mu, w: os.Stderr, prefix: prefix, hold: o.mode == Grouped}
+
+	return out, err, func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		out.flush()
+		err.flush()
+	}
+}
+
+// lineWriter only writes complete lines to the underlying writer,
+// which keeps the output of concurrent tasks from being torn apart.
+// Lines are prefixed with `prefix`, and held back until flushed
+// when `hold` is set.
+type lineWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	hold   bool
+	buf    []byte
+}
+
+// Write implements io.Writer.
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf = append(l.buf, p...)
+
+	if l.hold {
+		return len(p), nil
+	}
+
+	i := bytes.LastIndexByte(l.buf, '\n')
+	if i == -1 {
+		return len(p), nil
+	}
+
+	if err := l.write(l.buf[:i+1]); err != nil {
+		return 0, err
+	}
+
+	l.buf = append(l.buf[:0], l.buf[i+1:]...)
+	return len(p), nil
+}
+
+// flush writes anything buffered, the caller must hold the lock.
+func (l *lineWriter) flush() error {
+	if len(l.buf) == 0 {
+		return nil
+	}
+
+	if l.buf[len(l.buf)-1] != '\n' {
+		l.buf = append(l.buf, '\n')
+	}
+
+	err := l.write(l.buf)
+	l.buf = l.buf[:0]
+	return err
+}
+
+// write writes the complete lines of `b` with their prefix.
+func (l *lineWriter) write(b []byte) error {
+	if l.prefix == "" {
+		_, err := l.w.Write(b)
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		buf.WriteString(l.prefix)
+		buf.Write(line)
+	}
+
+	_, err := l.w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/tj/robo/config"
+	"github.com/tj/robo/task"
+	"github.com/tj/robo/watch"
+)
+
+// Debounce is the time to wait for changes to settle before the task is restarted.
+var Debounce = 200 * time.Millisecond
+
+// Watch runs the task and restarts it whenever one of its watched files
+// changes. The process group of the previous run is killed first.
+func Watch(c *config.Config, name string, args []string, o Options) {
+	t, args, out := setup(c, name, args, o)
+
+	if !t.Watchable() {
+		Fatalf("task %q has nothing to watch (add watch or sources)", name)
+	}
+
+	w, err := watch.New(t.LookupPath, t.Skips)
+	if err != nil {
+		Fatalf("error watching %s: %s", t.LookupPath, err)
+	}
+	defer w.Close()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			if errs := run(ctx, c, t, args, o, out); len(errs) > 0 && ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "\n  error(s): \n%s\n", listErrors(errs))
+			}
+		}()
+
+		path, ok := changed(w, t, interrupt)
+		cancel()
+		<-done
+
+		if !ok {
+			return
+		}
+
+		if rel, err := filepath.Rel(t.LookupPath, path); err == nil {
+			path = rel
+		}
+		fmt.Fprintf(os.Stderr, "\n  %s changed, restarting %s\n\n", path, name)
+	}
+}
+
+// changed waits for a watched file of the task `t` to change, and for
+// subsequent changes to settle. It returns the first changed path, or
+// false when interrupted.
+func changed(w *watch.Watcher, t *task.Task, interrupt chan os.Signal) (string, bool) {
+	var first string
+	var settled <-chan time.Time
+
+	for {
+		select {
+		case path := <-w.Events:
+			if !t.Watches(path) {
+				continue
+			}
+
+			if first == "" {
+				first = path
+			}
+			settled = time.After(Debounce)
+		case err := <-w.Errors:
+			Fatalf("error watching %s: %s", t.LookupPath, err)
+		case <-settled:
+			return first, true
+		case <-interrupt:
+			return "", false
+		}
+	}
+}
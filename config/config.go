@@ -5,6 +5,8 @@ import (
 	"io/ioutil"
 	"os/user"
 	"path"
+	"sort"
+	"strings"
 
 	"github.com/tj/robo/interpolation"
 	"gopkg.in/yaml.v2"
@@ -15,30 +17,80 @@ import (
 // Config represents the main YAML configuration
 // loaded for Robo tasks.
 type Config struct {
-	Before    []*task.Runnable
-	After     []*task.Runnable
-	File      string
-	Tasks     map[string]*task.Task `yaml:",inline"`
-	Variables map[string]interface{}
-	Templates struct {
+	Before     []*task.Runnable
+	After      []*task.Runnable
+	OnSuccess  []*task.Runnable `yaml:"on_success"`
+	OnFailure  []*task.Runnable `yaml:"on_failure"`
+	Finally    []*task.Runnable
+	Dir        string
+	Shell      string
+	Env        task.EnvList
+	EnvFile    task.StringList `yaml:"env_file"`
+	EnvInherit task.StringList `yaml:"env_inherit"`
+	FileEnv    []string        `yaml:"-"`
+	Overridden []string        `yaml:"-"`
+	Profiles   map[string]*Profile
+	Profile    string `yaml:"-"`
+	File       string
+	Include    map[string]string
+	Included   map[string]*Config    `yaml:"-"`
+	Tasks      map[string]*task.Task `yaml:",inline"`
+	Variables  map[string]interface{}
+	Templates  struct {
 		List      string
 		Help      string
 		Variables string
 	}
+
+	// fileEnvVar is set when the variables of the env
+	// files are exposed as the variable env.
+	fileEnvVar bool
+
+	// roboVar is set when robo's internal variables
+	// are exposed as the variable robo.
+	roboVar bool
 }
 
 // Eval evaluates the config by interpolating
 // all templates using the variables.
 func (c *Config) Eval() error {
 	var err error
-	err = interpolation.Vars(&c.Variables)
+	err = interpolation.VarsShell(&c.Variables, c.Shell)
 	if err != nil {
 		return fmt.Errorf("failed interpolating variables. Error: %v", err)
 	}
 
-	err = interpolation.Tasks(c.Tasks, c.Variables)
+	err = interpolation.Strings("dir", c.Variables, &c.Dir)
 	if err != nil {
-		return fmt.Errorf("failed interpolating tasks. Error: %v", err)
+		return fmt.Errorf("failed interpolating dir. Error: %v", err)
+	}
+
+	for i := range c.Env {
+		err = interpolation.Strings("env-var", c.Variables, &c.Env[i])
+		if err != nil {
+			return fmt.Errorf("failed interpolating env. Error: %v", err)
+		}
+	}
+
+	// Tasks of the global file see its own robo variables.
+	files := make(map[string]map[string]*task.Task)
+	for name, t := range c.Tasks {
+		if files[t.File] == nil {
+			files[t.File] = make(map[string]*task.Task)
+		}
+		files[t.File][name] = t
+	}
+
+	for file, tasks := range files {
+		data := c.Variables
+		if c.roboVar && file != c.File {
+			data = interpolation.With(data, "robo", c.roboVars(file))
+		}
+
+		err = interpolation.Tasks(tasks, data)
+		if err != nil {
+			return fmt.Errorf("failed interpolating tasks. Error: %v", err)
+		}
 	}
 
 	err = interpolation.Optionals("before", c.Before, c.Variables)
@@ -50,11 +102,109 @@ func (c *Config) Eval() error {
 	if err != nil {
 		return fmt.Errorf("failed interpolating after optionals. Error: %v", err)
 	}
+
+	err = interpolation.Hooks(c.OnSuccess, c.OnFailure, c.Finally, c.Variables)
+	if err != nil {
+		return fmt.Errorf("failed interpolating hooks. Error: %v", err)
+	}
 	return nil
 }
 
+// Options for loading a configuration.
+type Options struct {
+	// Global is a user-level configuration file merged
+	// under the loaded file, it is ignored when empty.
+	Global string
+
+	// Vars override variables before they are interpolated, each
+	// given as key.path=value. Later ones take precedence.
+	Vars []string
+
+	// Profile is the name of the profile to apply, if any.
+	Profile string
+
+	// EnvProfile is the name of the profile selected by the environment,
+	// which applies when Profile is empty and the configuration defines
+	// profiles.
+	EnvProfile string
+}
+
 // New configuration loaded from `file`.
 func New(file string) (*Config, error) {
+	return Load(file, Options{})
+}
+
+// Load configuration from `file` with options.
+func Load(file string, o Options) (*Config, error) {
+	c, err := read(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Global != "" && o.Global != file {
+		g, err := read(o.Global)
+		if err != nil {
+			return nil, fmt.Errorf("failed loading global configuration. Error: %v", err)
+		}
+		c.merge(g)
+	}
+
+	if o.Profile == "" && len(c.Profiles) > 0 {
+		o.Profile = o.EnvProfile
+	}
+
+	if o.Profile != "" {
+		if err := c.apply(o.Profile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.override(o.Vars); err != nil {
+		return nil, err
+	}
+
+	if err := c.init(nil, o); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// load the configuration `file` included by `parents`. The profile of
+// the including file is applied when the file defines it, as are the
+// variable overrides.
+func load(file string, parents []string, o Options) (*Config, error) {
+	c, err := read(file)
+	if err != nil {
+		return nil, err
+	}
+
+	name := o.Profile
+	if name == "" {
+		name = o.EnvProfile
+	}
+
+	if _, ok := c.Profiles[name]; ok {
+		if err := c.apply(name); err != nil {
+			return nil, err
+		}
+	} else {
+		c.Profile = o.Profile
+	}
+
+	if err := c.override(o.Vars); err != nil {
+		return nil, err
+	}
+
+	if err := c.init(parents, o); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// read the configuration `file` without evaluating it.
+func read(file string) (*Config, error) {
 	b, err := ioutil.ReadFile(file)
 	if err != nil {
 		return nil, err
@@ -66,6 +216,170 @@ func New(file string) (*Config, error) {
 	}
 	c.File = file
 
+	// Env files are relative to the file.
+	c.FileEnv, err = readEnvFiles(path.Dir(c.File), c.EnvFile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range c.Tasks {
+		if err := c.setup(t); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range c.Profiles {
+		for name, t := range p.Tasks {
+			t.Name = name
+			if err := c.setup(t); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Includes are relative to the file.
+	for ns, inc := range c.Include {
+		if !path.IsAbs(inc) {
+			c.Include[ns] = path.Join(path.Dir(c.File), inc)
+		}
+	}
+
+	return c, nil
+}
+
+// setup the task `t` defined in the file. Scripts are looked up relative
+// to the file, tasks without a dir, shell or env_inherit use the global ones.
+func (c *Config) setup(t *task.Task) error {
+	env, err := readEnvFiles(path.Dir(c.File), t.EnvFile)
+	if err != nil {
+		return err
+	}
+	t.FileEnv = env
+
+	t.LookupPath = path.Dir(c.File)
+	t.File = c.File
+	if t.Dir == "" {
+		t.Dir = c.Dir
+	}
+	if t.Shell == "" {
+		t.Shell = c.Shell
+	}
+	if t.EnvInherit == nil {
+		t.EnvInherit = c.EnvInherit
+	}
+	return nil
+}
+
+// readEnvFiles reads the variables of the env `files` relative to `dir`,
+// the variables of later files override the ones of earlier files.
+func readEnvFiles(dir string, files []string) ([]string, error) {
+	var env []string
+	for _, file := range files {
+		if !path.IsAbs(file) {
+			file = path.Join(dir, file)
+		}
+
+		vars, err := task.ReadEnvFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading env file. Error: %v", err)
+		}
+		env = append(env, vars...)
+	}
+	return env, nil
+}
+
+// merge the configuration `g` under c. Tasks, profiles, includes, variables,
+// env files and env of c take precedence, as do its templates when defined. The before
+// steps of `g` run before the ones of c, its after steps and hooks run after.
+func (c *Config) merge(g *Config) {
+	for name, t := range g.Tasks {
+		if _, ok := c.Tasks[name]; !ok {
+			if c.Tasks == nil {
+				c.Tasks = make(map[string]*task.Task)
+			}
+			c.Tasks[name] = t
+		}
+	}
+
+	for name, p := range g.Profiles {
+		if _, ok := c.Profiles[name]; !ok {
+			if c.Profiles == nil {
+				c.Profiles = make(map[string]*Profile)
+			}
+			c.Profiles[name] = p
+		}
+	}
+
+	for ns, inc := range g.Include {
+		if _, ok := c.Include[ns]; !ok {
+			if c.Include == nil {
+				c.Include = make(map[string]string)
+			}
+			c.Include[ns] = inc
+		}
+	}
+
+	c.Variables = mergeVariables(g.Variables, c.Variables)
+
+	if c.Templates.List == "" {
+		c.Templates.List = g.Templates.List
+	}
+
+	if c.Templates.Help == "" {
+		c.Templates.Help = g.Templates.Help
+	}
+
+	if c.Templates.Variables == "" {
+		c.Templates.Variables = g.Templates.Variables
+	}
+
+	c.FileEnv = append(append([]string(nil), g.FileEnv...), c.FileEnv...)
+	c.Env = append(append(task.EnvList{}, g.Env...), c.Env...)
+	c.Before = append(append([]*task.Runnable{}, g.Before...), c.Before...)
+	c.After = append(c.After, g.After...)
+	c.OnSuccess = append(c.OnSuccess, g.OnSuccess...)
+	c.OnFailure = append(c.OnFailure, g.OnFailure...)
+	c.Finally = append(c.Finally, g.Finally...)
+}
+
+// mergeVariables deeply merges the variables `b` into `a`,
+// values of `b` take precedence.
+func mergeVariables(a, b map[string]interface{}) map[string]interface{} {
+	if a == nil {
+		return b
+	}
+
+	for k, v := range b {
+		am, aok := a[k].(map[interface{}]interface{})
+		bm, bok := v.(map[interface{}]interface{})
+		if !aok || !bok {
+			a[k] = v
+			continue
+		}
+
+		merged := mergeVariables(stringKeys(am), stringKeys(bm))
+		m := make(map[interface{}]interface{}, len(merged))
+		for k, v := range merged {
+			m[k] = v
+		}
+		a[k] = m
+	}
+
+	return a
+}
+
+// stringKeys converts a YAML map to a map of strings.
+func stringKeys(m map[interface{}]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		ret[fmt.Sprintf("%v", k)] = v
+	}
+	return ret
+}
+
+// init adds the built-in variables, evaluates the configuration
+// and loads the included files.
+func (c *Config) init(parents []string, o Options) error {
 	// Initialize variables if needed.
 	if c.Variables == nil {
 		c.Variables = make(map[string]interface{})
@@ -74,10 +388,14 @@ func New(file string) (*Config, error) {
 	// Expose robo's internal variables
 	// but respect users who override them.
 	if _, ok := c.Variables["robo"]; !ok {
-		c.Variables["robo"] = map[string]string{
-			"path": path.Dir(c.File),
-			"file": c.File,
-		}
+		c.Variables["robo"] = c.roboVars(c.File)
+		c.roboVar = true
+	}
+
+	// Expose the variables of the env files.
+	if _, ok := c.Variables["env"]; !ok && len(c.FileEnv) > 0 {
+		c.Variables["env"] = envMap(c.FileEnv)
+		c.fileEnvVar = true
 	}
 
 	// Add the current user.
@@ -91,18 +409,165 @@ func New(file string) (*Config, error) {
 		}
 	}
 
+	for _, name := range c.Names() {
+		if err := c.Tasks[name].Validate(); err != nil {
+			return fmt.Errorf("invalid task %q. Error: %v", name, err)
+		}
+	}
+
 	// Interpolate variables.
 	if err := c.Eval(); err != nil {
-		return nil, err
+		return err
 	}
 
-	return c, nil
+	// Mount included tasks, they are
+	// already interpolated on their own.
+	if err := c.include(parents, o); err != nil {
+		return err
+	}
+
+	// The global env files and env apply to every task, including the
+	// included ones, and are overridden by the task's env files and env.
+	if len(c.FileEnv) > 0 || len(c.Env) > 0 {
+		for _, t := range c.Tasks {
+			t.GlobalEnv = append(append(append([]string(nil), c.FileEnv...), c.Env...), t.GlobalEnv...)
+		}
+	}
+
+	if err := c.checkDeps(false); err != nil {
+		return err
+	}
+
+	return c.checkRefs()
+}
+
+// include loads the included configuration files and mounts their
+// tasks under the namespace they were included with. For example
+// the task "build" included as "api" becomes "api:build".
+func (c *Config) include(parents []string, o Options) error {
+	parents = append(parents, c.File)
+
+	for _, ns := range sortedKeys(c.Include) {
+		file := c.Include[ns]
+
+		for _, parent := range parents {
+			if parent == file {
+				return fmt.Errorf("include cycle: %s includes %s", c.File, file)
+			}
+		}
+
+		inc, err := load(file, parents, o)
+		if err != nil {
+			return fmt.Errorf("failed including %q. Error: %v", ns, err)
+		}
+
+		steps := inc.Steps()
+		for _, nested := range inc.Namespaces() {
+			steps = append(steps, nested.Steps()...)
+		}
+
+		for _, r := range steps {
+			if r.Task != "" {
+				r.Task = ns + ":" + r.Task
+			}
+		}
+
+		for name, t := range inc.Tasks {
+			name = ns + ":" + name
+			if _, ok := c.Tasks[name]; ok {
+				return fmt.Errorf("included task %q is already defined", name)
+			}
+
+			for i, dep := range t.Deps {
+				t.Deps[i] = ns + ":" + dep
+			}
+
+			for _, r := range t.Runnables() {
+				if r.Task != "" {
+					r.Task = ns + ":" + r.Task
+				}
+			}
+
+			t.Name = name
+			if c.Tasks == nil {
+				c.Tasks = make(map[string]*task.Task)
+			}
+			c.Tasks[name] = t
+		}
+
+		// the global steps and hooks of the included file
+		// run once when any of its tasks run, see Namespaces.
+		if c.Included == nil {
+			c.Included = make(map[string]*Config)
+		}
+		c.Included[ns] = inc
+	}
+
+	return nil
+}
+
+// Namespaces returns the included configurations, including the
+// nested ones, by namespace. For example the configuration included
+// as "db" by the one included as "api" is returned as "api:db".
+func (c *Config) Namespaces() map[string]*Config {
+	ret := make(map[string]*Config)
+	for ns, inc := range c.Included {
+		ret[ns] = inc
+		for nested, inc := range inc.Namespaces() {
+			ret[ns+":"+nested] = inc
+		}
+	}
+	return ret
+}
+
+// Steps returns the global before and after steps and hooks.
+func (c *Config) Steps() []*task.Runnable {
+	var ret []*task.Runnable
+	for _, rs := range [][]*task.Runnable{c.Before, c.After, c.OnSuccess, c.OnFailure, c.Finally} {
+		ret = append(ret, rs...)
+	}
+	return ret
+}
+
+// roboVars returns robo's internal variables for the configuration `file`.
+func (c *Config) roboVars(file string) map[string]string {
+	return map[string]string{
+		"path":    path.Dir(file),
+		"file":    file,
+		"profile": c.Profile,
+	}
+}
+
+// envMap returns the variables of `env` by name.
+func envMap(env []string) map[string]string {
+	m := make(map[string]string)
+	for _, kv := range env {
+		if i := strings.Index(kv, "="); i != -1 {
+			m[kv[:i]] = kv[i+1:]
+		}
+	}
+	return m
+}
+
+// sortedKeys returns the sorted keys of `m`.
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // NewString configuration from string.
 func NewString(s string) (*Config, error) {
 	c := new(Config)
 
+	// tasks named after reserved keys would be taken for them.
+	if err := checkReserved(s); err != nil {
+		return nil, err
+	}
+
 	// unmarshal
 	err := yaml.Unmarshal([]byte(s), &c)
 	if err != nil {
@@ -114,5 +579,176 @@ func NewString(s string) (*Config, error) {
 		task.Name = name
 	}
 
+	// Dependencies on global or included tasks can
+	// only be resolved once loaded, cycles can't.
+	if err := c.checkDeps(true); err != nil {
+		return nil, err
+	}
+
 	return c, nil
 }
+
+// reserved holds the top-level keys added to the configuration
+// after tasks could already be defined with their names.
+var reserved = []string{
+	"dir",
+	"shell",
+	"env",
+	"env_file",
+	"env_inherit",
+	"on_success",
+	"on_failure",
+	"finally",
+	"include",
+	"profiles",
+}
+
+// checkReserved makes sure none of the reserved keys holds a task, which
+// is a map defining only task keys and a command, script, exec or deps.
+func checkReserved(s string) error {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal([]byte(s), &raw); err != nil {
+		return nil
+	}
+
+	for _, key := range reserved {
+		m, ok := raw[key].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+
+		b, err := yaml.Marshal(m)
+		if err != nil {
+			return err
+		}
+
+		var t task.Task
+		if err := yaml.UnmarshalStrict(b, &t); err != nil {
+			continue
+		}
+
+		if t.Command != "" || t.Script != "" || t.Exec != "" || len(t.Deps) > 0 {
+			return fmt.Errorf("%q is a reserved configuration key, rename the task", key)
+		}
+	}
+
+	return nil
+}
+
+// checkDeps makes sure no dependency cycles exist and, unless
+// `partial`, that every dependency refers to a defined task.
+func (c *Config) checkDeps(partial bool) error {
+	for _, name := range c.Names() {
+		for _, dep := range c.Tasks[name].Deps {
+			if _, ok := c.Tasks[dep]; !ok && !partial {
+				return fmt.Errorf("task %q depends on undefined task %q", name, dep)
+			}
+		}
+	}
+
+	if cycle := c.cycle(func(t *task.Task) []string { return t.Deps }); cycle != nil {
+		return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	return nil
+}
+
+// cycle returns the first cycle of tasks following the tasks returned by
+// `next`, if any. Undefined tasks are ignored.
+func (c *Config) cycle(next func(t *task.Task) []string) []string {
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	state := make(map[string]int)
+	var path []string
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			i := 0
+			for path[i] != name {
+				i++
+			}
+			return append(append([]string{}, path[i:]...), name)
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+
+		for _, n := range next(c.Tasks[name]) {
+			if _, ok := c.Tasks[n]; !ok {
+				continue
+			}
+
+			if cycle := visit(n); cycle != nil {
+				return cycle
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, name := range c.Names() {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+
+	return nil
+}
+
+// checkRefs makes sure every step referencing a task refers to a defined
+// task, and that the references don't form a cycle. Templated references
+// are only known once they run, which is when their cycles are detected.
+func (c *Config) checkRefs() error {
+	for _, r := range c.Steps() {
+		if _, ok := c.Tasks[r.Task]; r.Task != "" && !ok {
+			return fmt.Errorf("global step refers to undefined task %q", r.Task)
+		}
+	}
+
+	for _, name := range c.Names() {
+		for _, ref := range refs(c.Tasks[name]) {
+			if _, ok := c.Tasks[ref]; !ok {
+				return fmt.Errorf("task %q refers to undefined task %q", name, ref)
+			}
+		}
+	}
+
+	if cycle := c.cycle(refs); cycle != nil {
+		return fmt.Errorf("task reference cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	return nil
+}
+
+// refs returns the tasks referenced by the steps of `t`, except for the
+// references of tasks with parameters or flags which are interpolated
+// once they are run.
+func refs(t *task.Task) []string {
+	var ret []string
+	for _, r := range t.Runnables() {
+		if r.Task == "" || t.Vars != nil && strings.Contains(r.Task, "{{") {
+			continue
+		}
+		ret = append(ret, r.Task)
+	}
+	return ret
+}
+
+// Names returns the sorted task names.
+func (c *Config) Names() []string {
+	var names []string
+	for name := range c.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -3,10 +3,13 @@ package config_test
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/bmizerany/assert"
 	"github.com/tj/robo/config"
+	"github.com/tj/robo/task"
 )
 
 var s = `
@@ -97,3 +100,479 @@ func TestNew(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.Equal(t, file, c.File)
 }
+
+func TestNewString_depsOnly(t *testing.T) {
+	c, err := config.NewString(`
+build:
+  command: "true"
+all:
+  deps: [build]
+`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(c.Tasks["all"].Run(nil)))
+}
+
+// newFile returns the configuration loaded from a temporary file with `s`.
+func newFile(t *testing.T, s string) (*config.Config, error) {
+	f, err := ioutil.TempFile("", "")
+	assert.Equal(t, nil, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(s)
+	assert.Equal(t, nil, err)
+	f.Close()
+
+	return config.New(f.Name())
+}
+
+func TestNewString_reserved(t *testing.T) {
+	_, err := config.NewString(`
+env:
+  summary: output the environment
+  command: env
+`)
+	assert.Equal(t, `"env" is a reserved configuration key, rename the task`, err.Error())
+
+	_, err = config.NewString(`
+include:
+  command: ./include.sh
+`)
+	assert.Equal(t, `"include" is a reserved configuration key, rename the task`, err.Error())
+
+	_, err = config.NewString(`
+dir:
+  summary: show the directory
+  command: pwd
+`)
+	assert.Equal(t, `"dir" is a reserved configuration key, rename the task`, err.Error())
+
+	c, err := config.NewString(`
+env:
+  deps: "1"
+  COMMAND: make
+`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, task.EnvList{"COMMAND=make", "deps=1"}, c.Env)
+}
+
+func TestNewString_timeout(t *testing.T) {
+	c, err := config.NewString(`
+plan:
+  command: terraform plan
+  timeout: 10m
+  grace: 30s
+  before:
+    - command: terraform init
+      timeout: 1m
+`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 10*time.Minute, c.Tasks["plan"].Timeout)
+	assert.Equal(t, 30*time.Second, c.Tasks["plan"].Grace)
+	assert.Equal(t, time.Minute, c.Tasks["plan"].Before[0].Timeout)
+}
+
+func TestNewString_hooks(t *testing.T) {
+	c, err := config.NewString(`
+on_failure:
+  - command: echo failed
+finally:
+  - command: echo done
+deploy:
+  command: echo deploy
+  on_success:
+    - command: echo deployed
+`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"deploy"}, c.Names())
+	assert.Equal(t, "echo failed", c.OnFailure[0].Command)
+	assert.Equal(t, "echo done", c.Finally[0].Command)
+	assert.Equal(t, "echo deployed", c.Tasks["deploy"].OnSuccess[0].Command)
+}
+
+func TestNew_refs(t *testing.T) {
+	_, err := newFile(t, `
+deploy:
+  before:
+    - task: build
+  command: echo deploy
+`)
+	assert.Equal(t, `task "deploy" refers to undefined task "build"`, err.Error())
+
+	_, err = newFile(t, `
+loop3:
+  before:
+    - task: loop4
+  command: echo 3
+loop4:
+  after:
+    - task: loop3
+  command: echo 4
+`)
+	assert.Equal(t, "task reference cycle: loop3 -> loop4 -> loop3", err.Error())
+}
+
+func TestNew_dir(t *testing.T) {
+	c, err := newFile(t, `
+dir: web
+build:
+  command: npm run build
+release:
+  dir: "{{ .dist }}"
+  command: ./release.sh
+variables:
+  dist: /tmp/dist
+`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, filepath.Join(filepath.Dir(c.File), "web"), c.Tasks["build"].WorkDir())
+	assert.Equal(t, "/tmp/dist", c.Tasks["release"].WorkDir())
+}
+
+func TestNew_envFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("PROFILE=dev\nREGION=eu\n"), 0644)
+	assert.Equal(t, nil, err)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "prod.env"), []byte("PROFILE=prod\n"), 0644)
+	assert.Equal(t, nil, err)
+
+	file := filepath.Join(dir, "robo.yml")
+	err = ioutil.WriteFile(file, []byte(`
+env_file: .env
+dev:
+  command: echo {{ .env.PROFILE }}
+prod:
+  env_file: [prod.env]
+  command: echo {{ .env.PROFILE }} {{ .env.REGION }}
+`), 0644)
+	assert.Equal(t, nil, err)
+
+	c, err := config.New(file)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"PROFILE=dev", "REGION=eu"}, c.FileEnv)
+	assert.Equal(t, "echo dev", c.Tasks["dev"].Command)
+	assert.Equal(t, "echo prod eu", c.Tasks["prod"].Command)
+	assert.Equal(t, []string{"PROFILE=prod"}, c.Tasks["prod"].FileEnv)
+	assert.Equal(t, []string{"PROFILE=dev", "REGION=eu"}, c.Tasks["prod"].GlobalEnv)
+}
+
+func TestNew_envPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "global.env"), []byte("A=global_file\nB=global_file\nC=global_file\nD=global_file\n"), 0644)
+	assert.Equal(t, nil, err)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "task.env"), []byte("C=task_file\nD=task_file\n"), 0644)
+	assert.Equal(t, nil, err)
+
+	file := filepath.Join(dir, "robo.yml")
+	err = ioutil.WriteFile(file, []byte(`
+env_file: global.env
+env:
+  B: global_env
+  C: global_env
+  D: global_env
+deploy:
+  env_inherit: none
+  env_file: task.env
+  env:
+    D: task_env
+  command: echo deploy
+`), 0644)
+	assert.Equal(t, nil, err)
+
+	c, err := config.New(file)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"A=global_file", "B=global_env", "C=task_file", "D=task_env"}, c.Tasks["deploy"].Environ())
+}
+
+func TestNew_env(t *testing.T) {
+	c, err := newFile(t, `
+env:
+  AWS_PROFILE: shared
+  REGION: "{{ .region }}"
+deploy:
+  env:
+    REGION: us
+    EMPTY:
+  command: echo deploy
+  before:
+    - command: echo before
+      env: [STEP=1]
+build:
+  env: [MODE=release]
+  command: echo build
+variables:
+  region: eu
+`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, task.EnvList{"AWS_PROFILE=shared", "REGION=eu"}, c.Env)
+	assert.Equal(t, []string{"EMPTY=", "REGION=us"}, c.Tasks["deploy"].Env)
+	assert.Equal(t, []string{"AWS_PROFILE=shared", "REGION=eu"}, c.Tasks["deploy"].GlobalEnv)
+	assert.Equal(t, []string{"MODE=release"}, c.Tasks["build"].Env)
+	assert.Equal(t, []string{"AWS_PROFILE=shared", "REGION=eu"}, c.Tasks["build"].GlobalEnv)
+	assert.Equal(t, []string{"STEP=1"}, c.Tasks["deploy"].Before[0].Env)
+}
+
+func TestNew_deps(t *testing.T) {
+	c, err := newFile(t, `
+build:
+  command: echo build
+test:
+  command: echo test
+deploy:
+  deps: [build, test]
+  command: echo deploy
+`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"build", "test"}, c.Tasks["deploy"].Deps)
+
+	_, err = newFile(t, `
+deploy:
+  deps: [build]
+  command: echo deploy
+`)
+	assert.Equal(t, `task "deploy" depends on undefined task "build"`, err.Error())
+
+	_, err = newFile(t, `
+a:
+  deps: [b]
+b:
+  deps: [c]
+c:
+  deps: [a]
+`)
+	assert.Equal(t, "dependency cycle: a -> b -> c -> a", err.Error())
+
+	_, err = config.NewString(`
+a:
+  deps: [b, other]
+b:
+  deps: [a]
+`)
+	assert.Equal(t, "dependency cycle: a -> b -> a", err.Error())
+}
+
+func TestNew_include(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	err = os.MkdirAll(filepath.Join(dir, "api"), 0755)
+	assert.Equal(t, nil, err)
+
+	root := filepath.Join(dir, "robo.yml")
+	err = ioutil.WriteFile(root, []byte(`
+include:
+  api: api/robo.yml
+
+deploy:
+  deps: [api:build]
+  command: echo {{ .name }}
+
+variables:
+  name: root
+`), 0644)
+	assert.Equal(t, nil, err)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "api", "robo.yml"), []byte(`
+before:
+  - command: echo before
+
+build:
+  deps: [generate]
+  command: echo {{ .name }}
+  after:
+    - task: generate
+
+generate:
+  script: generate.sh
+
+variables:
+  name: api
+`), 0644)
+	assert.Equal(t, nil, err)
+
+	c, err := config.New(root)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(c.Tasks))
+	assert.Equal(t, "api:generate", c.Tasks["api:build"].After[0].Task)
+	assert.Equal(t, "echo root", c.Tasks["deploy"].Command)
+	assert.Equal(t, dir, c.Tasks["deploy"].LookupPath)
+
+	build := c.Tasks["api:build"]
+	assert.Equal(t, "api:build", build.Name)
+	assert.Equal(t, "echo api", build.Command)
+	assert.Equal(t, []string{"api:generate"}, build.Deps)
+	assert.Equal(t, 0, len(build.Before))
+	assert.Equal(t, "echo before", c.Included["api"].Before[0].Command)
+	assert.Equal(t, filepath.Join(dir, "api"), c.Tasks["api:generate"].LookupPath)
+}
+
+func TestLoad_includeOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "robo.yml")
+	err = ioutil.WriteFile(root, []byte(`
+include:
+  api: api.yml
+
+deploy:
+  command: echo {{ .name }} {{ .robo.profile }}
+
+variables:
+  name: root
+
+profiles:
+  prod:
+    variables:
+      name: root-prod
+`), 0644)
+	assert.Equal(t, nil, err)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "api.yml"), []byte(`
+build:
+  command: echo {{ .name }} {{ .region }} {{ .robo.profile }}
+
+variables:
+  name: api
+  region: eu
+
+profiles:
+  prod:
+    variables:
+      name: api-prod
+`), 0644)
+	assert.Equal(t, nil, err)
+
+	c, err := config.Load(root, config.Options{Profile: "prod", Vars: []string{"region=us"}})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "echo root-prod prod", c.Tasks["deploy"].Command)
+	assert.Equal(t, "echo api-prod us prod", c.Tasks["api:build"].Command)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "api.yml"), []byte(`
+build:
+  command: echo {{ .name }} {{ .robo.profile }}
+
+variables:
+  name: api
+`), 0644)
+	assert.Equal(t, nil, err)
+
+	c, err = config.Load(root, config.Options{Profile: "prod"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "echo api prod", c.Tasks["api:build"].Command)
+}
+
+func TestFind(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	repo := filepath.Join(dir, "repo")
+	sub := filepath.Join(repo, "a", "b")
+	err = os.MkdirAll(sub, 0755)
+	assert.Equal(t, nil, err)
+
+	file := filepath.Join(repo, "a", ".robo.yml")
+	err = ioutil.WriteFile(file, nil, 0644)
+	assert.Equal(t, nil, err)
+
+	found, err := config.Find(sub)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, file, found)
+
+	// stop at the repository boundary
+	err = ioutil.WriteFile(filepath.Join(dir, "robo.yml"), nil, 0644)
+	assert.Equal(t, nil, err)
+	err = os.Mkdir(filepath.Join(repo, ".git"), 0755)
+	assert.Equal(t, nil, err)
+
+	_, err = config.Find(repo)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestLoad_global(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "global.env"), []byte("TOKEN=secret\n"), 0644)
+	assert.Equal(t, nil, err)
+
+	global := filepath.Join(dir, "global.yml")
+	err = ioutil.WriteFile(global, []byte(`
+env_file: global.env
+
+before:
+  - command: echo global before
+
+login:
+  summary: global login
+  command: echo login {{ .aws.profile }}
+
+path:
+  summary: global path
+  command: echo {{ .robo.file }}
+
+deploy:
+  summary: global deploy
+
+templates:
+  list: global list
+  help: global help
+
+variables:
+  aws:
+    profile: default
+    region: us-east-1
+`), 0644)
+	assert.Equal(t, nil, err)
+
+	file := filepath.Join(dir, "robo.yml")
+	err = ioutil.WriteFile(file, []byte(`
+before:
+  - command: echo project before
+
+deploy:
+  summary: project deploy
+  deps: [login]
+
+templates:
+  help: project help
+
+variables:
+  aws:
+    profile: project
+`), 0644)
+	assert.Equal(t, nil, err)
+
+	c, err := config.Load(file, config.Options{Global: global})
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, "project deploy", c.Tasks["deploy"].Summary)
+	assert.Equal(t, file, c.Tasks["deploy"].File)
+	assert.Equal(t, global, c.Tasks["login"].File)
+	assert.Equal(t, "echo login project", c.Tasks["login"].Command)
+	assert.Equal(t, "echo "+global, c.Tasks["path"].Command)
+	assert.Equal(t, "us-east-1", c.Variables["aws"].(map[interface{}]interface{})["region"])
+
+	assert.Equal(t, "global list", c.Templates.List)
+	assert.Equal(t, "project help", c.Templates.Help)
+
+	assert.Equal(t, 2, len(c.Before))
+	assert.Equal(t, "echo global before", c.Before[0].Command)
+	assert.Equal(t, "echo project before", c.Before[1].Command)
+
+	assert.Equal(t, []string{"TOKEN=secret"}, c.Tasks["deploy"].GlobalEnv)
+	_, ok := c.Variables["env"]
+	assert.Equal(t, true, ok)
+	_, ok = c.ListedVariables()["env"]
+	assert.Equal(t, false, ok)
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultFile is the configuration file loaded when none is given.
+const DefaultFile = "robo.yml"
+
+// Files are the configuration file names looked up by Find, in order.
+var Files = []string{DefaultFile, "robo.yaml", ".robo.yml"}
+
+// Find looks for a configuration file in `dir` and its parents, much
+// like git looks for its repository. The search stops at the root of
+// the filesystem or at a repository boundary (a directory containing
+// .git), whichever comes first.
+func Find(dir string) (string, error) {
+	for d := dir; ; {
+		for _, name := range Files {
+			file := filepath.Join(d, name)
+			if stat, err := os.Stat(file); err == nil && !stat.IsDir() {
+				return file, nil
+			}
+		}
+
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			break
+		}
+
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+
+	return "", fmt.Errorf("no %s found in %s or any of its parent directories", DefaultFile, dir)
+}
+
+// GlobalFile returns the path of the user-level configuration file,
+// $XDG_CONFIG_HOME/robo/robo.yml, or an empty string when the
+// configuration directory cannot be determined.
+func GlobalFile() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "robo", DefaultFile)
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tj/robo/task"
+)
+
+// ProfileEnv is the environment variable selecting the profile.
+const ProfileEnv = "ROBO_PROFILE"
+
+// Profile overrides the variables, env and tasks of the configuration.
+type Profile struct {
+	Variables map[string]interface{}
+	Env       task.EnvList
+	Tasks     map[string]*task.Task
+}
+
+// apply the profile `name`. Its variables are deeply merged into the
+// variables and marked as overridden, its env is added to the global
+// env and its tasks replace the tasks of the same name.
+func (c *Config) apply(name string) error {
+	p, ok := c.Profiles[name]
+	if !ok && len(c.Profiles) == 0 {
+		return fmt.Errorf("undefined profile %q (no profiles are defined)", name)
+	}
+
+	if !ok {
+		var names []string
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("undefined profile %q (defined: %s)", name, strings.Join(names, ", "))
+	}
+
+	c.Profile = name
+	c.Variables = mergeVariables(c.Variables, p.Variables)
+	c.Overridden = append(c.Overridden, keyPaths("", p.Variables)...)
+	c.Env = append(c.Env, p.Env...)
+
+	for name, t := range p.Tasks {
+		if c.Tasks == nil {
+			c.Tasks = make(map[string]*task.Task)
+		}
+		c.Tasks[name] = t
+	}
+
+	return nil
+}
+
+// keyPaths returns the sorted key paths of the values of the variables `v`,
+// e.g. "hosts.stage" for the key stage of the map hosts.
+func keyPaths(prefix string, v interface{}) []string {
+	var keys []string
+	switch m := v.(type) {
+	case map[string]interface{}:
+		for k, v := range m {
+			keys = append(keys, keyPaths(prefix+k+".", v)...)
+		}
+	case map[interface{}]interface{}:
+		for k, v := range m {
+			keys = append(keys, keyPaths(fmt.Sprintf("%s%v.", prefix, k), v)...)
+		}
+	default:
+		return []string{strings.TrimSuffix(prefix, ".")}
+	}
+	sort.Strings(keys)
+	return keys
+}
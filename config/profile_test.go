@@ -0,0 +1,98 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/bmizerany/assert"
+	"github.com/tj/robo/config"
+)
+
+func TestLoad_profile(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	assert.Equal(t, nil, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(`
+hello:
+  command: echo {{ .hosts.stage }} {{ .robo.profile }}
+deploy:
+  command: echo local
+variables:
+  hosts:
+    stage: bastion-stage
+    prod: bastion-prod
+env:
+  TARGET: dev
+profiles:
+  prod:
+    variables:
+      hosts:
+        stage: bastion-2
+    env:
+      TARGET: prod
+    tasks:
+      deploy:
+        command: echo {{ .hosts.prod }}
+`)
+	assert.Equal(t, nil, err)
+	f.Close()
+
+	c, err := config.Load(f.Name(), config.Options{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "echo bastion-stage ", c.Tasks["hello"].Command)
+	assert.Equal(t, "echo local", c.Tasks["deploy"].Command)
+
+	c, err = config.Load(f.Name(), config.Options{Profile: "prod"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "prod", c.Profile)
+	assert.Equal(t, []string{"hosts.stage"}, c.Overridden)
+	assert.Equal(t, "echo bastion-2 prod", c.Tasks["hello"].Command)
+	assert.Equal(t, []string{"TARGET=dev", "TARGET=prod"}, c.Tasks["hello"].GlobalEnv)
+	assert.Equal(t, "deploy", c.Tasks["deploy"].Name)
+	assert.Equal(t, f.Name(), c.Tasks["deploy"].File)
+	assert.Equal(t, "echo bastion-prod", c.Tasks["deploy"].Command)
+
+	c, err = config.Load(f.Name(), config.Options{Profile: "prod", Vars: []string{"hosts.stage=b3"}})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "echo b3 prod", c.Tasks["hello"].Command)
+
+	c, err = config.Load(f.Name(), config.Options{EnvProfile: "prod"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "prod", c.Profile)
+
+	c, err = config.Load(f.Name(), config.Options{Profile: "prod", EnvProfile: "stage"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "prod", c.Profile)
+
+	_, err = config.Load(f.Name(), config.Options{Profile: "stage"})
+	assert.Equal(t, `undefined profile "stage" (defined: prod)`, err.Error())
+}
+
+func TestLoad_profileUndefined(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	assert.Equal(t, nil, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(`
+hello:
+  command: echo {{ .robo.profile }}
+`)
+	assert.Equal(t, nil, err)
+	f.Close()
+
+	// the profile of the environment may be meant for other configurations
+	c, err := config.Load(f.Name(), config.Options{EnvProfile: "prod"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "", c.Profile)
+	assert.Equal(t, "echo ", c.Tasks["hello"].Command)
+
+	robo := c.ListedVariables()["robo"].(map[interface{}]interface{})
+	_, ok := robo["profile"]
+	assert.Equal(t, false, ok)
+	assert.Equal(t, f.Name(), robo["file"])
+
+	_, err = config.Load(f.Name(), config.Options{Profile: "prod"})
+	assert.Equal(t, `undefined profile "prod" (no profiles are defined)`, err.Error())
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VarPrefix is the prefix of environment variables overriding variables.
+const VarPrefix = "ROBO_VAR_"
+
+// EnvVars returns the variable overrides of the environment `environ`.
+// The name of a variable following VarPrefix is the lower-cased key path
+// with double underscores separating the keys, e.g. ROBO_VAR_HOSTS__STAGE
+// overrides hosts.stage.
+func EnvVars(environ []string) []string {
+	var vars []string
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, VarPrefix) {
+			continue
+		}
+
+		kv = strings.TrimPrefix(kv, VarPrefix)
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			continue
+		}
+
+		key := strings.ToLower(strings.Replace(kv[:i], "__", ".", -1))
+		vars = append(vars, key+kv[i:])
+	}
+	return vars
+}
+
+// override sets the variables `vars` given as key.path=value,
+// later variables take precedence over earlier ones.
+func (c *Config) override(vars []string) error {
+	for _, kv := range vars {
+		i := strings.Index(kv, "=")
+		if i == -1 {
+			return fmt.Errorf("invalid variable %q (use key.path=value)", kv)
+		}
+
+		keys := strings.Split(kv[:i], ".")
+		for _, k := range keys {
+			if k == "" {
+				return fmt.Errorf("invalid variable %q (use key.path=value)", kv)
+			}
+		}
+
+		if c.Variables == nil {
+			c.Variables = make(map[string]interface{})
+		}
+
+		keys[0] = matchKey(c.Variables, keys[0])
+		if len(keys) == 1 {
+			c.Variables[keys[0]] = kv[i+1:]
+		} else {
+			m, ok := c.Variables[keys[0]].(map[interface{}]interface{})
+			if !ok {
+				m = make(map[interface{}]interface{})
+				c.Variables[keys[0]] = m
+			}
+			set(m, keys[1:], kv[i+1:])
+		}
+
+		c.Overridden = append(c.Overridden, strings.Join(keys, "."))
+	}
+	return nil
+}
+
+// set the value of the key path `keys` in the YAML map `m`, creating
+// maps for keys which are missing or not maps. The keys are replaced
+// with the keys of the map they match.
+func set(m map[interface{}]interface{}, keys []string, value string) {
+	keys[0] = matchYAMLKey(m, keys[0])
+	if len(keys) == 1 {
+		m[keys[0]] = value
+		return
+	}
+
+	sub, ok := m[keys[0]].(map[interface{}]interface{})
+	if !ok {
+		sub = make(map[interface{}]interface{})
+		m[keys[0]] = sub
+	}
+	set(sub, keys[1:], value)
+}
+
+// matchKey returns the key of `m` matching `key`, ignoring
+// the case unless `key` is defined as is.
+func matchKey(m map[string]interface{}, key string) string {
+	if _, ok := m[key]; ok {
+		return key
+	}
+	for k := range m {
+		if strings.EqualFold(k, key) {
+			return k
+		}
+	}
+	return key
+}
+
+// matchYAMLKey is like matchKey for YAML maps.
+func matchYAMLKey(m map[interface{}]interface{}, key string) string {
+	if _, ok := m[key]; ok {
+		return key
+	}
+	for k := range m {
+		if s, ok := k.(string); ok && strings.EqualFold(s, key) {
+			return s
+		}
+	}
+	return key
+}
+
+// ListedVariables returns the variables without the ones of the env
+// files exposed as env, which often hold secrets and aren't listed, and
+// without robo.profile when no profile is active.
+func (c *Config) ListedVariables() map[string]interface{} {
+	ret := make(map[string]interface{}, len(c.Variables))
+	for k, v := range c.Variables {
+		switch {
+		case k == "env" && c.fileEnvVar:
+		case k == "robo" && c.roboVar && c.Profile == "":
+			ret[k] = withoutKey(v, "profile")
+		default:
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// withoutKey returns a copy of the map `v` without `key`.
+func withoutKey(v interface{}, key string) interface{} {
+	switch m := v.(type) {
+	case map[string]string:
+		ret := make(map[string]string, len(m))
+		for k, v := range m {
+			if k != key {
+				ret[k] = v
+			}
+		}
+		return ret
+	case map[interface{}]interface{}:
+		ret := make(map[interface{}]interface{}, len(m))
+		for k, v := range m {
+			if k != key {
+				ret[k] = v
+			}
+		}
+		return ret
+	}
+	return v
+}
@@ -0,0 +1,47 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/bmizerany/assert"
+	"github.com/tj/robo/config"
+)
+
+func TestEnvVars(t *testing.T) {
+	vars := config.EnvVars([]string{"HOME=/root", "ROBO_VAR_HOSTS__STAGE=b2", "ROBO_VAR_REGION=eu=1", "ROBO_VAR_=x"})
+	assert.Equal(t, []string{"hosts.stage=b2", "region=eu=1"}, vars)
+}
+
+func TestLoad_vars(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	assert.Equal(t, nil, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(`
+hello:
+  command: echo {{ .dns }}
+variables:
+  awsProfile: dev
+  hosts:
+    stage: bastion-stage
+  dns: "dns.{{ .hosts.stage }}"
+  upper: "$(echo {{ .hosts.stage }} | tr a-z A-Z)"
+`)
+	assert.Equal(t, nil, err)
+	f.Close()
+
+	c, err := config.Load(f.Name(), config.Options{
+		Vars: []string{"hosts.stage=env", "hosts.stage=b2", "awsprofile=prod", "new.key=v"},
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "echo dns.b2", c.Tasks["hello"].Command)
+	assert.Equal(t, "B2", c.Variables["upper"])
+	assert.Equal(t, "prod", c.Variables["awsProfile"])
+	assert.Equal(t, "v", c.Variables["new"].(map[interface{}]interface{})["key"])
+	assert.Equal(t, []string{"hosts.stage", "hosts.stage", "awsProfile", "new.key"}, c.Overridden)
+
+	_, err = config.Load(f.Name(), config.Options{Vars: []string{"hosts."}})
+	assert.Equal(t, `invalid variable "hosts." (use key.path=value)`, err.Error())
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/mattn/go-shellwords"
 	"github.com/tj/robo/task"
 	"gopkg.in/yaml.v2"
 )
@@ -19,6 +20,12 @@ var commandPattern = regexp.MustCompile("\\$\\((.+)\\)")
 // Vars interpolates a given map of interfaces (strings or submaps) with itself
 // returning it with populated template values.
 func Vars(vars *map[string]interface{}) error {
+	return VarsShell(vars, "")
+}
+
+// VarsShell interpolates variables like Vars, `$(...)` commands are run by
+// the given shell followed by the command, e.g. "bash -c".
+func VarsShell(vars *map[string]interface{}, shell string) error {
 	b, err := yaml.Marshal(*vars)
 	if err != nil {
 		return err
@@ -30,7 +37,7 @@ func Vars(vars *map[string]interface{}) error {
 		return err
 	}
 
-	err = interpolateVariableCommands(&s)
+	err = interpolateVariableCommands(&s, shell)
 	if err != nil {
 		return fmt.Errorf("failed replacing variable placeholder with command result")
 	}
@@ -42,14 +49,14 @@ func Vars(vars *map[string]interface{}) error {
 	return err
 }
 
-func interpolateVariableCommands(s *string) error {
+func interpolateVariableCommands(s *string, shell string) error {
 	// find all commands
 	matches := commandPattern.FindAllStringSubmatch(*s, -1)
 	for _, match := range matches {
 		if len(match) != 2 {
 			continue
 		}
-		cmdOut, err := captureCommandOutput(match[1])
+		cmdOut, err := captureCommandOutput(match[1], shell)
 		if err != nil {
 			return fmt.Errorf("error while executing command. Error: %s", err)
 		}
@@ -58,64 +65,176 @@ func interpolateVariableCommands(s *string) error {
 	return nil
 }
 
-// captureCommandOutput executes a command and captures the output which usually gets prompted to stdout.
-func captureCommandOutput(args string) (string, error) {
-	var cmd *exec.Cmd
-	// try to use the user's default shell. If it is not set via env var fall back to `sh`.
-	if defaultShell, ok := os.LookupEnv("SHELL"); ok {
-		cmd = exec.Command(defaultShell, "-c", args)
-	} else {
-		cmd = exec.Command("sh", "-c", args)
+// captureCommandOutput executes a command via the `shell`, task.DefaultShell
+// when empty, and captures the output which usually gets prompted to stdout.
+func captureCommandOutput(args string, shell string) (string, error) {
+	if shell == "" {
+		shell = task.DefaultShell
+	}
+
+	fields, err := shellwords.Parse(shell)
+	if err != nil {
+		return "", err
 	}
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty shell")
+	}
+
+	cmd := exec.Command(fields[0], append(fields[1:], args)...)
 	var b bytes.Buffer
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = &b
 	cmd.Stderr = os.Stderr
-	err := cmd.Run()
+	err = cmd.Run()
 	return strings.TrimSuffix(b.String(), "\n"), err
 }
 
-// Tasks interpolates a given task with a set of data replacing placeholders
-// in the command, summary, script, exec and envs properties. If applicable the optionals 'before' and 'after' are also
-// interpolated.
+// Tasks interpolates the given tasks with a set of data. Tasks with parameters or flags
+// are interpolated once they are run, only their summary, usage and examples are
+// interpolated with Placeholders. The data they are run with is kept in their Vars.
 func Tasks(tasks map[string]*task.Task, data map[string]interface{}) error {
 	for _, task := range tasks {
-		// interpolate the tasks main fields
-		err := interpolate(
-			"task",
-			data,
-			&task.Command,
-			&task.Summary,
-			&task.Script,
-			&task.Exec,
-			&task.Usage,
-		)
-		if err != nil {
-			return err
-		}
-
-		// interpolate a task's environment data
-		for i, item := range task.Env {
-			if err := interpolate("env-var", data, &item); err != nil {
+		data := withEnv(data, task)
+		if len(task.Params) == 0 && len(task.Flags) == 0 {
+			if err := Task(task, data); err != nil {
 				return err
 			}
-			task.Env[i] = item
+			continue
 		}
 
-		// interpolate a task's list of examples
-		if err := Examples(task.Examples, data); err != nil {
+		placeholders := Placeholders(data, task)
+		if err := interpolate("task", placeholders, &task.Summary, &task.Usage); err != nil {
 			return err
 		}
 
-		// interpolate a task's before and after steps
-		if err := Optionals("before", task.Before, data); err != nil {
+		if err := Examples(task.Examples, placeholders); err != nil {
 			return err
 		}
-		if err := Optionals("after", task.After, data); err != nil {
+
+		task.Vars = data
+	}
+	return nil
+}
+
+// Placeholders returns a copy of data in which the parameters and flags of the task `t`
+// are shown by name, e.g. `{{ .params.env }}` interpolates to `<env>`.
+func Placeholders(data map[string]interface{}, t *task.Task) map[string]interface{} {
+	if len(t.Params) > 0 {
+		params := make(map[string]string)
+		for _, p := range t.Params {
+			params[p.Name] = "<" + p.Name + ">"
+		}
+		data = With(data, "params", params)
+	}
+
+	if len(t.Flags) > 0 {
+		flags := make(map[string]string)
+		for _, f := range t.Flags {
+			flags[f.Key()] = "<" + f.Name + ">"
+		}
+		data = With(data, "flags", flags)
+	}
+
+	return data
+}
+
+// withEnv returns data with the variables of the env files of the task `t`
+// exposed as env over the global ones, unless a variable named env which
+// isn't a map is defined.
+func withEnv(data map[string]interface{}, t *task.Task) map[string]interface{} {
+	if len(t.EnvFile) == 0 {
+		return data
+	}
+
+	env := make(map[string]string)
+
+	switch m := data["env"].(type) {
+	case nil:
+	case map[string]string:
+		for k, v := range m {
+			env[k] = v
+		}
+	case map[interface{}]interface{}:
+		for k, v := range m {
+			env[fmt.Sprintf("%v", k)] = fmt.Sprintf("%v", v)
+		}
+	default:
+		return data
+	}
+
+	for _, kv := range t.FileEnv {
+		if i := strings.Index(kv, "="); i != -1 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+
+	return With(data, "env", env)
+}
+
+// With returns a copy of data with `key` set to `value`.
+func With(data map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		ret[k] = v
+	}
+	ret[key] = value
+	return ret
+}
+
+// Task interpolates a given task with a set of data replacing placeholders
+// in the command, summary, script, exec and envs properties. If applicable the optionals 'before' and 'after' and
+// the hooks are also interpolated.
+func Task(task *task.Task, data map[string]interface{}) error {
+	// interpolate the tasks main fields
+	err := interpolate(
+		"task",
+		data,
+		&task.Command,
+		&task.Summary,
+		&task.Script,
+		&task.Exec,
+		&task.Usage,
+		&task.Dir,
+	)
+	if err != nil {
+		return err
+	}
+
+	// interpolate a task's environment data
+	for i, item := range task.Env {
+		if err := interpolate("env-var", data, &item); err != nil {
 			return err
 		}
+		task.Env[i] = item
 	}
-	return nil
+
+	// interpolate a task's list of examples
+	if err := Examples(task.Examples, data); err != nil {
+		return err
+	}
+
+	// interpolate a task's status, before and after steps
+	if err := Optionals("status", task.Status, data); err != nil {
+		return err
+	}
+	if err := Optionals("before", task.Before, data); err != nil {
+		return err
+	}
+	if err := Optionals("after", task.After, data); err != nil {
+		return err
+	}
+	return Hooks(task.OnSuccess, task.OnFailure, task.Finally, data)
+}
+
+// Hooks interpolates the on_success, on_failure and finally runnables of a task or the overall robo configuration.
+func Hooks(onSuccess, onFailure, finally []*task.Runnable, data map[string]interface{}) error {
+	if err := Optionals("on_success", onSuccess, data); err != nil {
+		return err
+	}
+	if err := Optionals("on_failure", onFailure, data); err != nil {
+		return err
+	}
+	return Optionals("finally", finally, data)
 }
 
 // Examples interpolates the list of examples (description and command attribute) for a task
@@ -141,15 +260,34 @@ func Optionals(id string, rs []*task.Runnable, data map[string]interface{}) erro
 			&step.Command,
 			&step.Exec,
 			&step.Script,
+			&step.Task,
+			&step.Dir,
 		)
 		if err != nil {
 			return err
 		}
+		for j, arg := range step.Args {
+			if err := interpolate(id, data, &arg); err != nil {
+				return err
+			}
+			step.Args[j] = arg
+		}
+		for j, item := range step.Env {
+			if err := interpolate("env-var", data, &item); err != nil {
+				return err
+			}
+			step.Env[j] = item
+		}
 		rs[i] = step
 	}
 	return nil
 }
 
+// Strings interpolates the given strings with a set of data.
+func Strings(name string, data map[string]interface{}, temps ...*string) error {
+	return interpolate(name, data, temps...)
+}
+
 // interpolate populates a given slice of templates with actual values provided
 // in the data parameter.
 func interpolate(name string, data interface{}, temps ...*string) error {
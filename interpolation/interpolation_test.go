@@ -1,6 +1,7 @@
 package interpolation
 
 import (
+	"os"
 	"testing"
 
 	"github.com/bmizerany/assert"
@@ -34,6 +35,32 @@ func TestVars_whenValueIsCommand_shouldReplaceWithCommandResult(t *testing.T) {
 	assert.Equal(t, "World!", vars["bar"].(map[interface{}]interface{})["sub"])
 }
 
+func TestVarsShell_whenValueIsCommand_shouldUseShell(t *testing.T) {
+	vars := map[string]interface{}{
+		"foo": "$(echo $0)",
+	}
+
+	err := VarsShell(&vars, "sh -c")
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "sh", vars["foo"])
+}
+
+func TestVars_whenValueIsCommand_shouldUseDefaultShell(t *testing.T) {
+	shell := os.Getenv("SHELL")
+	os.Setenv("SHELL", "/bin/false")
+	defer os.Setenv("SHELL", shell)
+
+	vars := map[string]interface{}{
+		"foo": "$(echo $0)",
+	}
+
+	err := Vars(&vars)
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "sh", vars["foo"])
+}
+
 func TestTasks(t *testing.T) {
 	tk := task.Task{
 		Summary: "This task handles {{ .foo }} World!",
@@ -76,3 +103,20 @@ func TestTasks(t *testing.T) {
 	assert.Equal(t, "Hello Example!", tk.Examples[0].Description)
 	assert.Equal(t, "robo Bye", tk.Examples[0].Command)
 }
+
+func TestTasks_whenTaskHasParams_shouldDeferInterpolation(t *testing.T) {
+	tk := task.Task{
+		Summary: "deploy to {{ .params.env }}",
+		Command: `deploy {{ .app }}{{ if eq .params.env "prod" }} --confirm{{ end }}`,
+		Params:  []*task.Param{{Name: "env"}},
+	}
+
+	err := Tasks(map[string]*task.Task{"tk": &tk}, map[string]interface{}{"app": "api"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "deploy to <env>", tk.Summary)
+	assert.Equal(t, `deploy {{ .app }}{{ if eq .params.env "prod" }} --confirm{{ end }}`, tk.Command)
+
+	err = Task(&tk, With(tk.Vars, "params", map[string]interface{}{"env": "prod"}))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "deploy api --confirm", tk.Command)
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/tj/docopt"
 	"github.com/tj/robo/cli"
@@ -12,15 +15,25 @@ var version = "0.8.0"
 
 const usage = `
   Usage:
-    robo [-q] [--config file]
-    robo <task> [<arg>...] [--config file]
-    robo help [<task>] [--config file]
-    robo variables [--config file]
+    robo [-q] [options]
+    robo [options] <task> [<arg>...]
+    robo [options] help [<task>]
+    robo [options] variables
+    robo [options] watch <task> [<arg>...]
+    robo [options] env <task> [<arg>...]
     robo -h | --help
     robo --version
 
   Options:
-    -c, --config file   config file to load [default: robo.yml]
+    -c, --config file   config file to load, defaults to the nearest robo.yml
+    -n, --no-discover   only look for robo.yml in the current directory
+    -G, --no-global     do not merge the global configuration
+    -p, --profile name  profile to apply, defaults to $ROBO_PROFILE
+    --var key=value     override a variable, may be repeated
+    -j, --jobs n        number of tasks to run in parallel [default: 1]
+    -o, --output mode   interleaved, prefixed or grouped [default: interleaved]
+    -f, --force         run tasks even when they are up to date
+    -V, --verbose       explain why tasks are skipped
     -h, --help          output help information
     -v, --version       output version
     -q, --quiet         output task names only
@@ -33,24 +46,83 @@ const usage = `
     output task help
     $ robo help mytask
 
+    run a task with 4 parallel jobs
+    $ robo -j 4 mytask
+
+    run a task again whenever its files change
+    $ robo watch mytask
+
+    output the environment of a task
+    $ robo env mytask
+
+    run a task with the prod profile
+    $ robo -p prod mytask
+
+    run a task with an overridden variable
+    $ robo --var hosts.stage=bastion-2 mytask
+
 `
 
 func main() {
-	args, err := docopt.Parse(usage, nil, true, version, true)
+	argv, vars := extractVars(os.Args[1:])
+
+	args, err := docopt.Parse(usage, argv, true, version, true)
 	if err != nil {
 		cli.Fatalf("error parsing arguments: %s", err)
 	}
 
-	abs, err := filepath.Abs(args["--config"].(string))
+	file, ok := args["--config"].(string)
+	if !ok {
+		file = config.DefaultFile
+	}
+
+	if !ok && !args["--no-discover"].(bool) {
+		wd, err := os.Getwd()
+		if err != nil {
+			cli.Fatalf("cannot resolve working directory: %s", err)
+		}
+
+		file, err = config.Find(wd)
+		if err != nil {
+			cli.Fatalf("error loading configuration: %s", err)
+		}
+	}
+
+	abs, err := filepath.Abs(file)
 	if err != nil {
 		cli.Fatalf("cannot resolve --config: %s", err)
 	}
 
-	c, err := config.New(abs)
+	opts := config.Options{
+		Vars:       append(config.EnvVars(os.Environ()), vars...),
+		EnvProfile: os.Getenv(config.ProfileEnv),
+	}
+	if profile, ok := args["--profile"].(string); ok {
+		opts.Profile = profile
+	}
+	if !args["--no-global"].(bool) {
+		if global := config.GlobalFile(); global != "" {
+			if _, err := os.Stat(global); err == nil {
+				opts.Global = global
+			}
+		}
+	}
+
+	c, err := config.Load(abs, opts)
 	if err != nil {
 		cli.Fatalf("error loading configuration: %s", err)
 	}
 
+	// tasks named after the watch and env commands take
+	// priority, as they did before the commands existed.
+	for _, command := range []string{"watch", "env"} {
+		if _, ok := c.Tasks[command]; ok && args[command].(bool) {
+			argv := append([]string{args["<task>"].(string)}, args["<arg>"].([]string)...)
+			cli.Run(c, command, argv, options(args))
+			return
+		}
+	}
+
 	switch {
 	case args["help"].(bool):
 		if name, ok := args["<task>"].(string); ok {
@@ -60,9 +132,13 @@ func main() {
 		}
 	case args["variables"].(bool):
 		cli.ListVariables(c)
+	case args["watch"].(bool):
+		cli.Watch(c, args["<task>"].(string), args["<arg>"].([]string), options(args))
+	case args["env"].(bool):
+		cli.Env(c, args["<task>"].(string), args["<arg>"].([]string))
 	default:
 		if name, ok := args["<task>"].(string); ok {
-			cli.Run(c, name, args["<arg>"].([]string))
+			cli.Run(c, name, args["<arg>"].([]string), options(args))
 			return
 		}
 
@@ -73,3 +149,57 @@ func main() {
 		}
 	}
 }
+
+// extractVars returns `argv` without the --var options preceding the
+// command, which docopt can't repeat, along with their values.
+func extractVars(argv []string) ([]string, []string) {
+	var rest, vars []string
+
+	for i := 0; i < len(argv); i++ {
+		arg := argv[i]
+
+		switch {
+		case arg == "--var" && i+1 < len(argv):
+			i++
+			vars = append(vars, argv[i])
+			continue
+		case strings.HasPrefix(arg, "--var="):
+			vars = append(vars, strings.TrimPrefix(arg, "--var="))
+			continue
+		}
+
+		rest = append(rest, arg)
+
+		// options taking a value
+		switch arg {
+		case "-c", "--config", "-j", "--jobs", "-o", "--output", "-p", "--profile":
+			if i+1 < len(argv) {
+				i++
+				rest = append(rest, argv[i])
+			}
+			continue
+		}
+
+		// the command and its arguments
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			return append(rest, argv[i+1:]...), vars
+		}
+	}
+
+	return rest, vars
+}
+
+// options returns the options for running tasks.
+func options(args map[string]interface{}) cli.Options {
+	jobs, err := strconv.Atoi(args["--jobs"].(string))
+	if err != nil || jobs < 1 {
+		cli.Fatalf("--jobs must be a positive number")
+	}
+
+	return cli.Options{
+		Jobs:    jobs,
+		Output:  args["--output"].(string),
+		Force:   args["--force"].(bool),
+		Verbose: args["--verbose"].(bool),
+	}
+}
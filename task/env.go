@@ -0,0 +1,250 @@
+package task
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// StringList is a list of strings which may also
+// be given as a single string in the configuration.
+type StringList []string
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (l *StringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		*l = StringList{s}
+		return nil
+	}
+
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+
+	*l = list
+	return nil
+}
+
+// EnvList is a list of KEY=value variables which may also
+// be given as a map of variables in the configuration.
+type EnvList []string
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (l *EnvList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var m map[string]interface{}
+	if err := unmarshal(&m); err == nil {
+		var keys []string
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		env := EnvList{}
+		for _, k := range keys {
+			v := m[k]
+			if v == nil {
+				v = ""
+			}
+			env = append(env, fmt.Sprintf("%s=%v", k, v))
+		}
+
+		*l = env
+		return nil
+	}
+
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+
+	*l = list
+	return nil
+}
+
+// Environ returns the environment the task's command runs with, sorted by name.
+func (t *Task) Environ() []string {
+	env := merge(Inherited(t.EnvInherit), t.options(nil).Env)
+	sort.Strings(env)
+	return env
+}
+
+// Inherited returns the variables of the current process matching
+// the name or glob `patterns`. All variables are inherited when the
+// patterns are empty or "all", none of them for "none".
+func Inherited(patterns []string) []string {
+	if len(patterns) == 0 || len(patterns) == 1 && patterns[0] == "all" {
+		return os.Environ()
+	}
+
+	var env []string
+	for _, kv := range os.Environ() {
+		name := kv
+		if i := strings.Index(kv, "="); i != -1 {
+			name = kv[:i]
+		}
+
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, name); ok && p != "none" {
+				env = append(env, kv)
+				break
+			}
+		}
+	}
+	return env
+}
+
+// checkInherit makes sure the inherit `patterns` are valid.
+func checkInherit(patterns []string) error {
+	for _, p := range patterns {
+		if (p == "all" || p == "none") && len(patterns) > 1 {
+			return fmt.Errorf("env_inherit %q can't be combined with other patterns", p)
+		}
+
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid env_inherit pattern %q", p)
+		}
+	}
+	return nil
+}
+
+// ReadEnvFile reads the variables of the dotenv `file`.
+func ReadEnvFile(file string) ([]string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := ParseEnv(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", file, err)
+	}
+
+	return env, nil
+}
+
+// ParseEnv parses the variables of a dotenv file. Each line holds a KEY=value
+// pair optionally prefixed with `export`, blank lines and lines starting with
+// # are ignored. Values may be single quoted to be taken literally or double
+// quoted to support escape sequences, both of which may span multiple lines.
+// Unquoted values end at the first # preceded by whitespace.
+func ParseEnv(s string) ([]string, error) {
+	var env []string
+	line := 1
+
+	for {
+		s = strings.TrimLeft(s, " \t\r")
+		if s == "" {
+			return env, nil
+		}
+
+		switch s[0] {
+		case '\n':
+			s = s[1:]
+			line++
+			continue
+		case '#':
+			s = s[lineEnd(s):]
+			continue
+		}
+
+		if strings.HasPrefix(s, "export ") || strings.HasPrefix(s, "export\t") {
+			s = strings.TrimLeft(s[len("export"):], " \t")
+		}
+
+		i := strings.IndexAny(s, "=\n")
+		if i == -1 || s[i] != '=' {
+			return nil, fmt.Errorf("%d: expected KEY=value", line)
+		}
+
+		key := strings.TrimRight(s[:i], " \t")
+		if !validKey(key) {
+			return nil, fmt.Errorf("%d: invalid variable name %q", line, key)
+		}
+
+		s = strings.TrimLeft(s[i+1:], " \t")
+
+		var value string
+		if s != "" && (s[0] == '"' || s[0] == '\'') {
+			end := closingQuote(s)
+			if end == -1 {
+				return nil, fmt.Errorf("%d: unterminated quoted value of %s", line, key)
+			}
+
+			value = s[1:end]
+			line += strings.Count(value, "\n")
+			if s[0] == '"' {
+				value = unescape(value)
+			}
+
+			s = s[end+1:]
+			rest := strings.TrimSpace(s[:lineEnd(s)])
+			if rest != "" && rest[0] != '#' {
+				return nil, fmt.Errorf("%d: unexpected %q after quoted value of %s", line, rest, key)
+			}
+		} else {
+			value = s[:lineEnd(s)]
+			if i := strings.Index(value, " #"); i != -1 {
+				value = value[:i]
+			}
+			if i := strings.Index(value, "\t#"); i != -1 {
+				value = value[:i]
+			}
+			value = strings.TrimSpace(value)
+		}
+
+		s = s[lineEnd(s):]
+		env = append(env, key+"="+value)
+	}
+}
+
+// lineEnd returns the index of the end of the first line of `s`.
+func lineEnd(s string) int {
+	if i := strings.IndexByte(s, '\n'); i != -1 {
+		return i
+	}
+	return len(s)
+}
+
+// closingQuote returns the index of the quote closing the value
+// starting with a quote, escaped double quotes are skipped.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[0] == '"' && s[i] == '\\':
+			i++
+		case s[i] == s[0]:
+			return i
+		}
+	}
+	return -1
+}
+
+// unescape replaces the escape sequences of a double quoted value.
+func unescape(s string) string {
+	r := strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\r`, "\r", `\"`, `"`, `\\`, `\`, `\$`, "$")
+	return r.Replace(s)
+}
+
+// validKey returns true for valid variable names.
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	for i, c := range key {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		case c == '.' && i > 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
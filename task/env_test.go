@@ -0,0 +1,102 @@
+package task
+
+import (
+	"os"
+	"testing"
+
+	"github.com/bmizerany/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseEnv(t *testing.T) {
+	env, err := ParseEnv(`
+# comment
+export AWS_PROFILE=dev
+EMPTY=
+PLAIN = hello world # comment
+HASH=a#b
+SINGLE='raw $HOME \n # not a comment'
+DOUBLE="tab\there \"quoted\" \$HOME"
+MULTI="first
+second"
+`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{
+		"AWS_PROFILE=dev",
+		"EMPTY=",
+		"PLAIN=hello world",
+		"HASH=a#b",
+		`SINGLE=raw $HOME \n # not a comment`,
+		"DOUBLE=tab\there \"quoted\" $HOME",
+		"MULTI=first\nsecond",
+	}, env)
+}
+
+func TestParseEnv_errors(t *testing.T) {
+	_, err := ParseEnv("A=1\nB\n")
+	assert.Equal(t, "2: expected KEY=value", err.Error())
+
+	_, err = ParseEnv("A=\"1\n\nB=2\n")
+	assert.Equal(t, "1: unterminated quoted value of A", err.Error())
+
+	_, err = ParseEnv("A=\"1\" 2\n")
+	assert.Equal(t, `1: unexpected "2" after quoted value of A`, err.Error())
+
+	_, err = ParseEnv("1A=2\n")
+	assert.Equal(t, `1: invalid variable name "1A"`, err.Error())
+}
+
+func TestStringList(t *testing.T) {
+	var v struct{ Files StringList }
+
+	err := yaml.Unmarshal([]byte("files: .env"), &v)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, StringList{".env"}, v.Files)
+
+	err = yaml.Unmarshal([]byte("files: [.env, .env.local]"), &v)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, StringList{".env", ".env.local"}, v.Files)
+}
+
+func TestEnvList(t *testing.T) {
+	var v struct{ Env EnvList }
+
+	err := yaml.Unmarshal([]byte("env: [B=2, A=1]"), &v)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, EnvList{"B=2", "A=1"}, v.Env)
+
+	err = yaml.Unmarshal([]byte("env: {B: 2, A: one, C: }"), &v)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, EnvList{"A=one", "B=2", "C="}, v.Env)
+}
+
+func TestInherited(t *testing.T) {
+	os.Setenv("ROBO_TEST_A", "1")
+	os.Setenv("ROBO_TEST_B", "2")
+	defer os.Unsetenv("ROBO_TEST_A")
+	defer os.Unsetenv("ROBO_TEST_B")
+
+	assert.Equal(t, len(os.Environ()), len(Inherited(nil)))
+	assert.Equal(t, len(os.Environ()), len(Inherited([]string{"all"})))
+	assert.Equal(t, 0, len(Inherited([]string{"none"})))
+	assert.Equal(t, []string{"ROBO_TEST_A=1"}, Inherited([]string{"ROBO_TEST_A"}))
+	assert.Equal(t, []string{"ROBO_TEST_A=1", "ROBO_TEST_B=2"}, Inherited([]string{"ROBO_TEST_*"}))
+}
+
+func TestTask_Environ(t *testing.T) {
+	os.Setenv("ROBO_TEST_A", "1")
+	defer os.Unsetenv("ROBO_TEST_A")
+
+	tk := &Task{
+		EnvInherit: StringList{"ROBO_TEST_*"},
+		FileEnv:    []string{"B=file", "C=file"},
+		Env:        []string{"C=task"},
+	}
+	assert.Equal(t, []string{"B=file", "C=task", "ROBO_TEST_A=1"}, tk.Environ())
+}
+
+func TestCheckInherit(t *testing.T) {
+	assert.Equal(t, nil, checkInherit([]string{"PATH", "LC_*"}))
+	assert.Equal(t, `env_inherit "none" can't be combined with other patterns`, checkInherit([]string{"PATH", "none"}).Error())
+	assert.Equal(t, `invalid env_inherit pattern "["`, checkInherit([]string{"["}).Error())
+}
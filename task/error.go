@@ -0,0 +1,111 @@
+package task
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// Error is returned when the main runnable or a step of a task fails.
+type Error struct {
+	// Task is the name of the task.
+	Task string
+
+	// Step is the kind of the failing step such as "before",
+	// it is empty when the main runnable of the task failed.
+	Step string
+
+	// Index is the position of the failing step starting at 1.
+	Index int
+
+	// Err is the error of the runnable.
+	Err error
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	if e.Step == "" {
+		return fmt.Sprintf("task '%s' failed. Error: %+v", e.Task, e.Err)
+	}
+	return fmt.Sprintf("%s step #%d of task '%s' failed. Error: %+v", e.Step, e.Index, e.Task, e.Err)
+}
+
+// Unwrap returns the error of the runnable.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit code matching `err`. It is the exit status
+// of a failed process, 128 plus the signal number for processes killed
+// by a signal, 124 for timeouts and 1 for any other error.
+func ExitCode(err error) int {
+	for err != nil {
+		if _, ok := err.(*timeoutError); ok {
+			return 124
+		}
+
+		if ee, ok := err.(*exec.ExitError); ok {
+			if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+				return 128 + int(ws.Signal())
+			}
+			return ee.ExitCode()
+		}
+
+		err = unwrap(err)
+	}
+
+	return 1
+}
+
+// exitCode returns the exit status of the process which failed with `err`,
+// it returns false when the process didn't exit on its own.
+func exitCode(err error) (int, bool) {
+	for err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			ws, ok := ee.Sys().(syscall.WaitStatus)
+			if !ok || !ws.Exited() {
+				return 0, false
+			}
+			return ws.ExitStatus(), true
+		}
+
+		err = unwrap(err)
+	}
+
+	return 0, false
+}
+
+// unwrap returns the error wrapped by `err`, if any.
+func unwrap(err error) error {
+	if u, ok := err.(interface{ Unwrap() error }); ok {
+		return u.Unwrap()
+	}
+	return nil
+}
+
+// timeoutError is returned when a runnable times out.
+type timeoutError struct {
+	timeout time.Duration
+}
+
+// Error implements error.
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s", e.timeout)
+}
+
+// attemptsError is returned when all attempts of a runnable failed.
+type attemptsError struct {
+	attempts int
+	err      error
+}
+
+// Error implements error.
+func (e *attemptsError) Error() string {
+	return fmt.Sprintf("failed after %d attempts. Error: %v", e.attempts, e.err)
+}
+
+// Unwrap returns the error of the last attempt.
+func (e *attemptsError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,29 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	run := func(r *Runnable) error {
+		return r.RunContext(context.Background(), Options{})
+	}
+
+	assert.Equal(t, 3, ExitCode(run(&Runnable{Command: "exit 3"})))
+	assert.Equal(t, 143, ExitCode(run(&Runnable{Command: "kill -TERM $$"})))
+	assert.Equal(t, 124, ExitCode(run(&Runnable{Command: "sleep 10", Timeout: 50 * time.Millisecond})))
+	assert.Equal(t, 4, ExitCode(run(&Runnable{Command: "exit 4", Retries: 1})))
+	assert.Equal(t, 5, ExitCode(&Error{Task: "x", Err: run(&Runnable{Command: "exit 5"})}))
+	assert.Equal(t, 1, ExitCode(errors.New("boom")))
+}
+
+func TestError(t *testing.T) {
+	err := errors.New("boom")
+	assert.Equal(t, "task 'x' failed. Error: boom", (&Error{Task: "x", Err: err}).Error())
+	assert.Equal(t, "after step #2 of task 'x' failed. Error: boom", (&Error{Task: "x", Step: "after", Index: 2, Err: err}).Error())
+}
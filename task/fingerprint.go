@@ -0,0 +1,274 @@
+package task
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Methods used to tell whether a task is up to date.
+const (
+	// Checksum compares the content of the sources with the last run.
+	Checksum = "checksum"
+
+	// Timestamp compares the modification time of the sources with the
+	// generated files, or with the last run when nothing is generated.
+	Timestamp = "timestamp"
+)
+
+// StateDir is the directory, relative to the configuration,
+// where the fingerprints of tasks are stored.
+const StateDir = ".robo"
+
+// stateFile returns the path of the file holding the task's fingerprint.
+func (t *Task) stateFile() string {
+	name := strings.Replace(t.Name, string(filepath.Separator), "_", -1)
+	return filepath.Join(t.LookupPath, StateDir, name)
+}
+
+// sourcesUpToDate returns true when the task's sources did not change
+// since the task last succeeded and all of its generated files exist,
+// along with the reason when they did. With the checksum method the task
+// is also run again when its definition, arguments or environment changed.
+func (t *Task) sourcesUpToDate(o Options) (bool, string, error) {
+	sources, err := t.glob(t.Sources)
+	if err != nil {
+		return false, "", err
+	}
+
+	if len(sources) == 0 {
+		return false, "sources match no files", nil
+	}
+
+	generates, err := t.glob(t.Generates)
+	if err != nil {
+		return false, "", err
+	}
+
+	// every generated file pattern must match
+	for _, pattern := range t.Generates {
+		matches, err := t.glob([]string{pattern})
+		if err != nil || len(matches) == 0 {
+			return false, "generated files missing", err
+		}
+	}
+
+	switch t.Method {
+	case Timestamp:
+		ok, err := t.newer(sources, generates)
+		return ok, "sources changed", err
+	case Checksum, "":
+		sum, err := t.checksum(o, sources)
+		if err != nil {
+			return false, "", err
+		}
+
+		prev, err := ioutil.ReadFile(t.stateFile())
+		if os.IsNotExist(err) {
+			return false, "never run", nil
+		}
+
+		return string(prev) == sum, "sources, definition or arguments changed", err
+	default:
+		return false, "", fmt.Errorf("unknown method %q (use %s or %s)", t.Method, Checksum, Timestamp)
+	}
+}
+
+// newer returns true when the `generates` files are newer than the `sources`,
+// or when the last run is newer if nothing is generated.
+func (t *Task) newer(sources, generates []string) (bool, error) {
+	if len(generates) == 0 {
+		generates = []string{t.stateFile()}
+	}
+
+	var newest time.Time
+	for _, file := range sources {
+		stat, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+
+		if stat.ModTime().After(newest) {
+			newest = stat.ModTime()
+		}
+	}
+
+	for _, file := range generates {
+		stat, err := os.Stat(file)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if stat.ModTime().Before(newest) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// record stores the fingerprint of the task's sources.
+func (t *Task) record(o Options) error {
+	if len(t.Sources) == 0 {
+		return nil
+	}
+
+	var sum string
+	if t.Method != Timestamp {
+		sources, err := t.glob(t.Sources)
+		if err != nil {
+			return err
+		}
+
+		sum, err = t.checksum(o, sources)
+		if err != nil {
+			return err
+		}
+	}
+
+	file := t.stateFile()
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, []byte(sum), 0644)
+}
+
+// checksum returns a checksum of the task's definition, the arguments and
+// environment of `o` and the names and contents of `files`.
+func (t *Task) checksum(o Options, files []string) (string, error) {
+	h := sha256.New()
+
+	fmt.Fprintf(h, "%+v\x00%s\x00%s\x00%q\x00%q\x00", t.runnable(), t.Shell, t.Dir, o.Env, o.Args)
+
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+
+		rel, _ := filepath.Rel(t.LookupPath, file)
+		fmt.Fprintf(h, "%s\x00", rel)
+
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// glob returns the sorted files matching `patterns` relative to the
+// task's lookup path. Patterns may use `**` to match any number of
+// directories, e.g. "src/**/*.go".
+func (t *Task) glob(patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(t.LookupPath, pattern)
+		}
+
+		matches, err := glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range matches {
+			if !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// glob returns the files matching `pattern`, which may contain `**`.
+func glob(pattern string) ([]string, error) {
+	i := strings.Index(pattern, "**")
+	if i == -1 {
+		matches, err := filepath.Glob(pattern)
+		return files(matches), err
+	}
+
+	root := filepath.Dir(pattern[:i+1])
+	var matches []string
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && match(split(pattern), split(path)) {
+			matches = append(matches, path)
+		}
+
+		return nil
+	})
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return matches, err
+}
+
+// files filters out the directories of `paths`.
+func files(paths []string) []string {
+	var ret []string
+	for _, path := range paths {
+		if stat, err := os.Stat(path); err == nil && !stat.IsDir() {
+			ret = append(ret, path)
+		}
+	}
+	return ret
+}
+
+// split splits `path` into its elements.
+func split(path string) []string {
+	return strings.Split(filepath.Clean(path), string(filepath.Separator))
+}
+
+// match matches the `path` elements against the `pattern` elements,
+// where a `**` element matches any number of path elements.
+func match(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if match(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(path) == 0 {
+		return false
+	}
+
+	ok, err := filepath.Match(pattern[0], path[0])
+	if err != nil || !ok {
+		return false
+	}
+
+	return match(pattern[1:], path[1:])
+}
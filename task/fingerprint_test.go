@@ -0,0 +1,75 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestUpToDate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src", "pkg", "main.go")
+	assert.Equal(t, nil, os.MkdirAll(filepath.Dir(src), 0755))
+	assert.Equal(t, nil, ioutil.WriteFile(src, []byte("package main"), 0644))
+
+	tk := &Task{
+		Name:       "build",
+		LookupPath: dir,
+		Sources:    []string{"src/**/*.go"},
+		Generates:  []string{"bin/*"},
+	}
+
+	o := tk.options([]string{"-v"})
+	ok, _, err := tk.sourcesUpToDate(o)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, ok)
+
+	// recorded but nothing generated yet
+	assert.Equal(t, nil, tk.record(o))
+	ok, _, err = tk.sourcesUpToDate(o)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, ok)
+
+	assert.Equal(t, nil, os.MkdirAll(filepath.Join(dir, "bin"), 0755))
+	assert.Equal(t, nil, ioutil.WriteFile(filepath.Join(dir, "bin", "main"), nil, 0755))
+	ok, _, err = tk.sourcesUpToDate(o)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, ok)
+
+	// other arguments
+	ok, _, err = tk.sourcesUpToDate(tk.options(nil))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, ok)
+
+	// other definition
+	tk.Command = "go build"
+	ok, _, err = tk.sourcesUpToDate(o)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, ok)
+	tk.Command = ""
+
+	assert.Equal(t, nil, ioutil.WriteFile(src, []byte("package main // changed"), 0644))
+	ok, _, err = tk.sourcesUpToDate(o)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, ok)
+
+	tk.Sources = []string{"lib/**/*.go"}
+	ok, reason, err := tk.sourcesUpToDate(o)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, ok)
+	assert.Equal(t, "sources match no files", reason)
+}
+
+func TestMatch(t *testing.T) {
+	assert.Equal(t, true, match(split("src/**/*.go"), split("src/main.go")))
+	assert.Equal(t, true, match(split("src/**/*.go"), split("src/a/b/main.go")))
+	assert.Equal(t, false, match(split("src/**/*.go"), split("src/a/b/main.js")))
+	assert.Equal(t, false, match(split("src/**/*.go"), split("lib/main.go")))
+	assert.Equal(t, true, match(split("**"), split("a/b/c")))
+}
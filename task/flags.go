@@ -0,0 +1,199 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/tj/docopt"
+)
+
+// Flag describes an option of a task, such as `--region us-east-1`.
+type Flag struct {
+	Name    string
+	Short   string
+	Type    string
+	Default string
+	Help    string
+}
+
+// check makes sure the flag definition is valid.
+func (f *Flag) check() error {
+	f.Name = strings.TrimPrefix(f.Name, "--")
+	f.Short = strings.TrimPrefix(f.Short, "-")
+
+	if f.Name == "" {
+		return fmt.Errorf("flag name is missing")
+	}
+
+	if len(f.Short) > 1 {
+		return fmt.Errorf("short name of flag %q must be a single character", f.Name)
+	}
+
+	if f.Type == "" {
+		f.Type = "string"
+	}
+
+	if err := checkType("flag", f.Name, f.Type); err != nil {
+		return err
+	}
+
+	if f.Default != "" {
+		if _, err := parseValue("flag", f.Name, f.Type, f.Default); err != nil {
+			return fmt.Errorf("default of %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Key returns the name the flag is referred to with in templates,
+// e.g. the flag `--dry-run` becomes `{{ .flags.dry_run }}`.
+func (f *Flag) Key() string {
+	return strings.Replace(f.Name, "-", "_", -1)
+}
+
+// String returns the flag as displayed in the help output.
+func (f *Flag) String() string {
+	s := "--" + f.Name
+	if f.Type != "bool" {
+		s += " <" + f.Type + ">"
+	}
+
+	if f.Short != "" {
+		s = "-" + f.Short + ", " + s
+	}
+
+	return s
+}
+
+// usage returns the docopt usage of the task's flags.
+func (t *Task) usage() string {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "Usage:\n  %s [options]\n\nOptions:\n", t.Name)
+	for _, f := range t.Flags {
+		fmt.Fprintf(&b, "  %s  %s", f, strings.Replace(f.Help, "\n", " ", -1))
+		if f.Default != "" && f.Type != "bool" {
+			fmt.Fprintf(&b, " [default: %s]", f.Default)
+		}
+		fmt.Fprintln(&b)
+	}
+
+	return b.String()
+}
+
+// flag returns the flag matching the argument `arg`.
+func (t *Task) flag(arg string) *Flag {
+	for _, f := range t.Flags {
+		if arg == "--"+f.Name || (f.Short != "" && arg == "-"+f.Short) {
+			return f
+		}
+	}
+	return nil
+}
+
+// FlagPrefix is the prefix of the environment variables holding flags,
+// which keeps flags such as `--home` from overriding HOME.
+const FlagPrefix = "ROBO_FLAG_"
+
+// ParseFlags parses the task's flags out of `args`, returning their values
+// by key and the remaining arguments. Arguments which are not declared flags
+// are returned unchanged, as is everything from the "--" separator on. Bool
+// flags are turned off with `--no-name`, and the last of repeated flags wins.
+func (t *Task) ParseFlags(args []string) (map[string]interface{}, []string, error) {
+	if len(t.Flags) == 0 {
+		return nil, args, nil
+	}
+
+	// the arguments of the flags by key, the last one given wins.
+	given := make(map[string][]string)
+	var keys, rest []string
+	negated := make(map[string]bool)
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+
+		name := arg
+		if j := strings.Index(arg, "="); j != -1 && strings.HasPrefix(arg, "--") {
+			name = arg[:j]
+		}
+
+		f := t.flag(name)
+		if f == nil && strings.HasPrefix(arg, "--no-") {
+			if f := t.flag("--" + strings.TrimPrefix(arg, "--no-")); f != nil && f.Type == "bool" {
+				negated[f.Key()] = true
+				continue
+			}
+		}
+
+		if f == nil {
+			rest = append(rest, arg)
+			continue
+		}
+
+		delete(negated, f.Key())
+
+		if _, ok := given[f.Key()]; !ok {
+			keys = append(keys, f.Key())
+		}
+		given[f.Key()] = []string{arg}
+
+		if f.Type != "bool" && name == arg {
+			if i+1 == len(args) {
+				return nil, nil, fmt.Errorf("flag %s requires a value", arg)
+			}
+			i++
+			given[f.Key()] = append(given[f.Key()], args[i])
+		}
+	}
+
+	// docopt parses the process's arguments when given nil.
+	flags := []string{}
+	for _, key := range keys {
+		flags = append(flags, given[key]...)
+	}
+
+	opts, err := docopt.Parse(t.usage(), flags, false, "", false, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid flags %s for task %q: %v", strings.Join(flags, " "), t.Name, err)
+	}
+
+	values := make(map[string]interface{})
+
+	for _, f := range t.Flags {
+		var v interface{}
+
+		switch o := opts["--"+f.Name].(type) {
+		case string:
+			v, err = parseValue("flag", f.Name, f.Type, o)
+		case bool:
+			v = o
+			if !o && f.Default != "" {
+				v, err = parseValue("flag", f.Name, f.Type, f.Default)
+			}
+		default:
+			v = ""
+			if f.Type == "bool" {
+				v = false
+			}
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if negated[f.Key()] {
+			v = false
+		}
+
+		values[f.Key()] = v
+	}
+
+	return values, rest, nil
+}
@@ -0,0 +1,51 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestParseFlags(t *testing.T) {
+	tk := &Task{
+		Name: "deploy",
+		Flags: []*Flag{
+			{Name: "region", Short: "r", Default: "us-east-1"},
+			{Name: "dry-run", Type: "bool"},
+			{Name: "count", Type: "int"},
+		},
+	}
+	assert.Equal(t, nil, tk.Validate())
+
+	values, rest, err := tk.ParseFlags([]string{"prod", "-r", "eu-west-1", "--dry-run", "--other", "x"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[string]interface{}{"region": "eu-west-1", "dry_run": true, "count": ""}, values)
+	assert.Equal(t, []string{"prod", "--other", "x"}, rest)
+
+	values, rest, err = tk.ParseFlags([]string{"--count=3", "prod", "--", "--dry-run"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[string]interface{}{"region": "us-east-1", "dry_run": false, "count": 3}, values)
+	assert.Equal(t, []string{"prod", "--", "--dry-run"}, rest)
+
+	tk.Flags[1].Default = "true"
+	values, _, err = tk.ParseFlags(nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, values["dry_run"])
+
+	values, rest, err = tk.ParseFlags([]string{"--no-dry-run", "--no-region"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, values["dry_run"])
+	assert.Equal(t, []string{"--no-region"}, rest)
+
+	values, rest, err = tk.ParseFlags([]string{"--region", "us", "prod", "-r", "ap", "--dry-run", "--no-dry-run"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "ap", values["region"])
+	assert.Equal(t, false, values["dry_run"])
+	assert.Equal(t, []string{"prod"}, rest)
+
+	_, _, err = tk.ParseFlags([]string{"--count"})
+	assert.Equal(t, "flag --count requires a value", err.Error())
+
+	_, _, err = tk.ParseFlags([]string{"--count", "many"})
+	assert.Equal(t, `flag "count" must be of type int, got "many"`, err.Error())
+}
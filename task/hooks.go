@@ -0,0 +1,63 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// RunHooksContext runs the `onFailure` runnables when the run failed because
+// of `cause` and the `onSuccess` ones otherwise, followed by the `finally` runnables.
+// The failure hooks receive the failed task, step and exit code through
+// ROBO_FAILED_TASK, ROBO_FAILED_STEP and ROBO_EXIT_CODE.
+func RunHooksContext(ctx context.Context, parent string, onSuccess, onFailure, finally []*Runnable, cause error, o Options) []error {
+	var ret []error
+
+	if cause == nil {
+		if err := runOptionals(ctx, "on_success", parent, onSuccess, o); err != nil {
+			ret = append(ret, err)
+		}
+	} else {
+		f := o
+		f.Env = append(append([]string(nil), o.Env...), failureEnv(cause)...)
+		if err := runOptionals(ctx, "on_failure", parent, onFailure, f); err != nil {
+			ret = append(ret, err)
+		}
+	}
+
+	if err := runOptionals(ctx, "finally", parent, finally, o); err != nil {
+		ret = append(ret, err)
+	}
+
+	return ret
+}
+
+// Cause returns the error of `errs` which determines the outcome of running
+// the task `name`: the failure of the task's own runnable takes precedence,
+// otherwise it is the first error.
+func Cause(name string, errs []error) error {
+	for _, err := range errs {
+		if e, ok := err.(*Error); ok && e.Task == name && e.Step == "" {
+			return e
+		}
+	}
+	return errs[0]
+}
+
+// failureEnv returns the environment describing the failure `err`.
+func failureEnv(err error) []string {
+	var task, step string
+	if e, ok := err.(*Error); ok {
+		task = e.Task
+		step = "main"
+		if e.Step != "" {
+			step = fmt.Sprintf("%s #%d", e.Step, e.Index)
+		}
+	}
+
+	return []string{
+		"ROBO_FAILED_TASK=" + task,
+		"ROBO_FAILED_STEP=" + step,
+		"ROBO_EXIT_CODE=" + strconv.Itoa(ExitCode(err)),
+	}
+}
@@ -0,0 +1,37 @@
+package task
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestTask_Run_hooks(t *testing.T) {
+	var stdout bytes.Buffer
+	tk := &Task{
+		Name:      "deploy",
+		Command:   "exit 3",
+		After:     []*Runnable{{Command: "echo after"}},
+		OnSuccess: []*Runnable{{Command: "echo success"}},
+		OnFailure: []*Runnable{{Command: `echo "failure $ROBO_FAILED_TASK $ROBO_FAILED_STEP $ROBO_EXIT_CODE"`}},
+		Finally:   []*Runnable{{Command: "echo finally"}},
+		Stdout:    &stdout,
+	}
+
+	errs := tk.Run(nil)
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, "after\nfailure deploy main 3\nfinally\n", stdout.String())
+
+	stdout.Reset()
+	tk.Command = "true"
+	errs = tk.Run(nil)
+	assert.Equal(t, 0, len(errs))
+	assert.Equal(t, "after\nsuccess\nfinally\n", stdout.String())
+
+	stdout.Reset()
+	tk.After = []*Runnable{{Command: "exit 4"}}
+	errs = tk.Run(nil)
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, "failure deploy after #1 4\nfinally\n", stdout.String())
+}
@@ -0,0 +1,248 @@
+package task
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Param describes a named positional parameter of a task.
+type Param struct {
+	Name        string
+	Type        string
+	Required    bool
+	Default     string
+	Enum        []string
+	Description string
+}
+
+// Value types of parameters and flags.
+var types = []string{"string", "int", "float", "bool"}
+
+// check makes sure the parameter definition is valid.
+func (p *Param) check() error {
+	if p.Name == "" {
+		return fmt.Errorf("parameter name is missing")
+	}
+
+	if p.Type == "" {
+		p.Type = "string"
+	}
+
+	if err := checkType("parameter", p.Name, p.Type); err != nil {
+		return err
+	}
+
+	if p.Default != "" {
+		if _, err := p.parse(p.Default); err != nil {
+			return fmt.Errorf("default of %s", err)
+		}
+	}
+
+	return nil
+}
+
+// parse the parameter value `s` according to its type and enum.
+func (p *Param) parse(s string) (interface{}, error) {
+	if len(p.Enum) > 0 {
+		ok := false
+		for _, e := range p.Enum {
+			ok = ok || e == s
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("parameter %q must be one of %s, got %q", p.Name, strings.Join(p.Enum, ", "), s)
+		}
+	}
+
+	return parseValue("parameter", p.Name, p.Type, s)
+}
+
+// checkType makes sure `typ` is a known type.
+func checkType(kind, name, typ string) error {
+	for _, t := range types {
+		if t == typ {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s %q has unknown type %q (use %s)", kind, name, typ, strings.Join(types, ", "))
+}
+
+// parseValue parses `s` according to the type `typ`.
+func parseValue(kind, name, typ, s string) (interface{}, error) {
+	var v interface{}
+	var err error
+
+	switch typ {
+	case "int":
+		v, err = strconv.Atoi(s)
+	case "float":
+		v, err = strconv.ParseFloat(s, 64)
+	case "bool":
+		v, err = strconv.ParseBool(s)
+	default:
+		v = s
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s %q must be of type %s, got %q", kind, name, typ, s)
+	}
+
+	return v, nil
+}
+
+// Validate makes sure the task definition is valid.
+func (t *Task) Validate() error {
+	seen := make(map[string]bool)
+
+	for _, p := range t.Params {
+		if err := p.check(); err != nil {
+			return err
+		}
+
+		if seen[p.Name] {
+			return fmt.Errorf("parameter %q is defined more than once", p.Name)
+		}
+		seen[p.Name] = true
+	}
+
+	if err := checkInherit(t.EnvInherit); err != nil {
+		return err
+	}
+
+	r := t.runnable()
+	if err := r.check(); err != nil {
+		return err
+	}
+
+	steps := []struct {
+		kind string
+		rs   []*Runnable
+	}{
+		{"status", t.Status},
+		{"before", t.Before},
+		{"after", t.After},
+		{"on_success", t.OnSuccess},
+		{"on_failure", t.OnFailure},
+		{"finally", t.Finally},
+	}
+
+	for _, s := range steps {
+		for i, r := range s.rs {
+			if err := r.check(); err != nil {
+				return fmt.Errorf("%s step #%d: %v", s.kind, i+1, err)
+			}
+		}
+	}
+
+	switch t.Method {
+	case "", Checksum, Timestamp:
+	default:
+		return fmt.Errorf("unknown method %q (use %s or %s)", t.Method, Checksum, Timestamp)
+	}
+
+	seen = make(map[string]bool)
+
+	for _, f := range t.Flags {
+		if err := f.check(); err != nil {
+			return err
+		}
+
+		for _, name := range []string{"--" + f.Name, "-" + f.Short} {
+			if seen[name] {
+				return fmt.Errorf("flag %s is defined more than once", name)
+			}
+
+			if name != "-" {
+				seen[name] = true
+			}
+		}
+	}
+
+	return nil
+}
+
+// ParseParams validates the positional `args` against the task's
+// parameters and returns their values by name. Missing optional
+// parameters take their default value, extra arguments and the
+// ones following "--" are ignored.
+func (t *Task) ParseParams(args []string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	// arguments following "--" are passed through only.
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[:i]
+			break
+		}
+	}
+
+	for i, p := range t.Params {
+		s := p.Default
+		if i < len(args) {
+			s = args[i]
+		} else if p.Required {
+			return nil, fmt.Errorf("missing required parameter %q", p.Name)
+		} else if s == "" {
+			values[p.Name] = ""
+			continue
+		}
+
+		v, err := p.parse(s)
+		if err != nil {
+			return nil, err
+		}
+
+		values[p.Name] = v
+	}
+
+	return values, nil
+}
+
+// ParamsUsage returns the usage generated from the task's flags and parameters.
+func (t *Task) ParamsUsage() string {
+	var usage []string
+
+	if len(t.Flags) > 0 {
+		usage = append(usage, "[flags]")
+	}
+
+	for _, p := range t.Params {
+		if p.Required {
+			usage = append(usage, "<"+p.Name+">")
+		} else {
+			usage = append(usage, "["+p.Name+"]")
+		}
+	}
+
+	return strings.Join(usage, " ")
+}
+
+// ParamPrefix is the prefix of the environment variables holding parameters,
+// which keeps parameters such as `path` from overriding PATH.
+const ParamPrefix = "ROBO_PARAM_"
+
+// ParamsEnv returns the parameter or flag `values` as environment
+// variables, named after the upper-cased names following `prefix`.
+func ParamsEnv(prefix string, values map[string]interface{}) []string {
+	var env []string
+	for name, v := range values {
+		env = append(env, prefix+envName(name)+"="+fmt.Sprint(v))
+	}
+	return env
+}
+
+// envName returns `name` as an environment variable name.
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
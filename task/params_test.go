@@ -0,0 +1,58 @@
+package task
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestParseParams(t *testing.T) {
+	tk := &Task{
+		Params: []*Param{
+			{Name: "env", Required: true, Enum: []string{"dev", "prod"}},
+			{Name: "replicas", Type: "int", Default: "2"},
+			{Name: "tag"},
+		},
+	}
+	assert.Equal(t, nil, tk.Validate())
+	assert.Equal(t, "<env> [replicas] [tag]", tk.ParamsUsage())
+
+	values, err := tk.ParseParams([]string{"prod"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[string]interface{}{"env": "prod", "replicas": 2, "tag": ""}, values)
+
+	values, err = tk.ParseParams([]string{"dev", "5", "latest", "extra"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[string]interface{}{"env": "dev", "replicas": 5, "tag": "latest"}, values)
+
+	values, err = tk.ParseParams([]string{"dev", "--", "5"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, values["replicas"])
+
+	_, err = tk.ParseParams(nil)
+	assert.Equal(t, `missing required parameter "env"`, err.Error())
+
+	_, err = tk.ParseParams([]string{"stage"})
+	assert.Equal(t, `parameter "env" must be one of dev, prod, got "stage"`, err.Error())
+
+	_, err = tk.ParseParams([]string{"dev", "many"})
+	assert.Equal(t, `parameter "replicas" must be of type int, got "many"`, err.Error())
+}
+
+func TestValidate(t *testing.T) {
+	tk := &Task{Params: []*Param{{Name: "n", Type: "number"}}}
+	assert.Equal(t, `parameter "n" has unknown type "number" (use string, int, float, bool)`, tk.Validate().Error())
+
+	tk = &Task{Params: []*Param{{Name: "n", Type: "int", Default: "x"}}}
+	assert.Equal(t, `default of parameter "n" must be of type int, got "x"`, tk.Validate().Error())
+
+	tk = &Task{Before: []*Runnable{{Command: "true"}, {Command: "true", RetryOn: []int{1}}}}
+	assert.Equal(t, "before step #2: retry_on requires retries", tk.Validate().Error())
+}
+
+func TestParamsEnv(t *testing.T) {
+	env := ParamsEnv(ParamPrefix, map[string]interface{}{"path": "/tmp", "dry-run": true})
+	sort.Strings(env)
+	assert.Equal(t, []string{"ROBO_PARAM_DRY_RUN=true", "ROBO_PARAM_PATH=/tmp"}, env)
+}
@@ -0,0 +1,43 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// RunTaskFunc runs the task `name` with `args`, writing to the output of `o`.
+type RunTaskFunc func(ctx context.Context, name string, args []string, o Options) error
+
+// stackKey is the context key of the names of the running tasks.
+type stackKey struct{}
+
+// withTask returns a copy of ctx in which the task `name` is running.
+func withTask(ctx context.Context, name string) context.Context {
+	s := Stack(ctx)
+	return context.WithValue(ctx, stackKey{}, append(s[:len(s):len(s)], name))
+}
+
+// Stack returns the names of the running tasks in ctx,
+// a task is followed by the tasks it references.
+func Stack(ctx context.Context) []string {
+	s, _ := ctx.Value(stackKey{}).([]string)
+	return s
+}
+
+// runTask runs the referenced task, failing when it is already running, which
+// only templated references can cause as configurations reject other cycles.
+func (r *Runnable) runTask(ctx context.Context, o Options) error {
+	s := Stack(ctx)
+	for i, name := range s {
+		if name == r.Task {
+			return fmt.Errorf("recursive task reference: %s", strings.Join(append(s[i:len(s):len(s)], r.Task), " -> "))
+		}
+	}
+
+	if o.RunTask == nil {
+		return fmt.Errorf("cannot run task %q from here", r.Task)
+	}
+
+	return o.RunTask(ctx, r.Task, r.Args, o)
+}
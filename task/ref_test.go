@@ -0,0 +1,41 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestRunnable_task(t *testing.T) {
+	tasks := map[string]*Task{
+		"greet": {Name: "greet", Command: `echo "hello $1"`},
+		"loop":  {Name: "loop", Before: []*Runnable{{Task: "setup"}}},
+		"setup": {Name: "setup", Before: []*Runnable{{Task: "loop"}}},
+	}
+
+	var stdout bytes.Buffer
+	var run RunTaskFunc
+	run = func(ctx context.Context, name string, args []string, o Options) error {
+		tk := tasks[name].Clone()
+		tk.Stdout = o.Stdout
+		tk.RunTask = run
+		if errs := tk.RunContext(ctx, args); len(errs) > 0 {
+			return errs[0]
+		}
+		return nil
+	}
+
+	r := &Runnable{Task: "greet", Args: []string{"world"}}
+	err := r.RunContext(context.Background(), Options{Stdout: &stdout, RunTask: run})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "hello world\n", stdout.String())
+
+	r = &Runnable{Task: "loop"}
+	err = r.RunContext(context.Background(), Options{RunTask: run})
+	assert.Equal(t, "before step #1 of task 'loop' failed. Error: before step #1 of task 'setup' failed. Error: recursive task reference: loop -> setup -> loop", err.Error())
+
+	err = r.RunContext(context.Background(), Options{})
+	assert.Equal(t, `cannot run task "loop" from here`, err.Error())
+}
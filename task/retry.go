@@ -0,0 +1,71 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// retry attempts to run the runnable until it succeeds, it fails with an
+// exit code it isn't retried on or all of its retries are used up. Every
+// attempt is logged, and the delay between attempts is multiplied by the
+// backoff factor after each attempt.
+func (r *Runnable) retry(ctx context.Context, o Options) error {
+	stderr := o.Stderr
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+
+	attempts := r.Retries + 1
+	delay := r.RetryDelay
+
+	for i := 1; ; i++ {
+		fmt.Fprintf(stderr, "attempt %d of %d\n", i, attempts)
+
+		err := r.attempt(ctx, o)
+		if err == nil {
+			return nil
+		}
+
+		if i == attempts || ctx.Err() != nil || !r.retriable(err) {
+			if i == 1 {
+				return err
+			}
+			return &attemptsError{i, err}
+		}
+
+		fmt.Fprintf(stderr, "attempt %d failed (%v), retrying in %s\n", i, err, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if r.Backoff > 0 {
+			delay = time.Duration(float64(delay) * r.Backoff)
+		}
+	}
+}
+
+// retriable returns true when the runnable is retried after `err`, which is
+// the case for any error unless specific exit codes are retried on.
+func (r *Runnable) retriable(err error) bool {
+	if len(r.RetryOn) == 0 {
+		return true
+	}
+
+	code, ok := exitCode(err)
+	if !ok {
+		return false
+	}
+
+	for _, c := range r.RetryOn {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,55 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestRunnable_retry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "robo")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	// fails until the third attempt.
+	count := filepath.Join(dir, "count")
+	r := &Runnable{
+		Command:    `echo x >> ` + count + `; test $(wc -l < ` + count + `) -ge 3`,
+		Retries:    3,
+		RetryDelay: 10 * time.Millisecond,
+		Backoff:    2,
+	}
+
+	var stderr bytes.Buffer
+	err = r.RunContext(context.Background(), Options{Stderr: &stderr})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "attempt 1 of 4\nattempt 1 failed (exit status 1), retrying in 10ms\nattempt 2 of 4\nattempt 2 failed (exit status 1), retrying in 20ms\nattempt 3 of 4\n", stderr.String())
+}
+
+func TestRunnable_retry_exhausted(t *testing.T) {
+	r := &Runnable{Command: "exit 3", Retries: 2}
+	err := r.RunContext(context.Background(), Options{})
+	assert.Equal(t, "failed after 3 attempts. Error: exit status 3", err.Error())
+}
+
+func TestRunnable_retry_on(t *testing.T) {
+	r := &Runnable{Command: "exit 3", Retries: 2, RetryOn: []int{1, 2}}
+	err := r.RunContext(context.Background(), Options{})
+	assert.Equal(t, "exit status 3", err.Error())
+
+	r.RetryOn = []int{3}
+	err = r.RunContext(context.Background(), Options{})
+	assert.Equal(t, "failed after 3 attempts. Error: exit status 3", err.Error())
+}
+
+func TestRunnable_check(t *testing.T) {
+	assert.Equal(t, nil, (&Runnable{Retries: 1, RetryOn: []int{1}}).check())
+	assert.Equal(t, "retry_on requires retries", (&Runnable{RetryOn: []int{1}}).check().Error())
+	assert.Equal(t, "retries, retry_delay and backoff must not be negative", (&Runnable{Retries: -1}).check().Error())
+}
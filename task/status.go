@@ -0,0 +1,43 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// upToDate returns true when the task may be skipped, along with the
+// reason. A task is up to date when its sources did not change and all
+// of its status steps succeed, tasks without either are never up to date.
+func (t *Task) upToDate(ctx context.Context, o Options) (bool, string, error) {
+	if len(t.Sources) == 0 && len(t.Status) == 0 {
+		return false, "", nil
+	}
+
+	var reasons []string
+
+	if len(t.Sources) > 0 {
+		ok, reason, err := t.sourcesUpToDate(o)
+		if err != nil || !ok {
+			return false, reason, err
+		}
+		reasons = append(reasons, "sources unchanged")
+	}
+
+	// status steps are only checked for their exit code.
+	o.Stdout = ioutil.Discard
+	o.Stderr = ioutil.Discard
+
+	for i, r := range t.Status {
+		if err := r.run(ctx, o); err != nil {
+			return false, fmt.Sprintf("status step #%d failed: %s", i+1, err), nil
+		}
+	}
+
+	if len(t.Status) > 0 {
+		reasons = append(reasons, "status steps succeeded")
+	}
+
+	return true, strings.Join(reasons, " and "), nil
+}
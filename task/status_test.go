@@ -0,0 +1,22 @@
+package task
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestUpToDate_status(t *testing.T) {
+	tk := &Task{Name: "net", Status: []*Runnable{{Command: "true"}, {Command: "exit 1"}}}
+	ok, reason, err := tk.upToDate(context.Background(), tk.options(nil))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, ok)
+	assert.Equal(t, "status step #2 failed: exit status 1", reason)
+
+	tk.Status = tk.Status[:1]
+	ok, reason, err = tk.upToDate(context.Background(), tk.options(nil))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "status steps succeeded", reason)
+}
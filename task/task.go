@@ -1,13 +1,18 @@
 package task
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/mattn/go-shellwords"
 )
@@ -20,94 +25,633 @@ type Example struct {
 
 // Task definition.
 type Task struct {
-	LookupPath string
-	Name       string `yaml:"-"`
-	Summary    string
-	Command    string
-	Script     string
-	Exec       string
-	Usage      string
-	Examples   []*Example
-	Env        []string
-	Before     []*Runnable
-	After      []*Runnable
+	LookupPath  string
+	Name        string `yaml:"-"`
+	File        string `yaml:"-"`
+	Summary     string
+	Command     string
+	Script      string
+	Exec        string
+	Usage       string
+	Dir         string
+	Shell       string
+	Interpreter string
+	Examples    []*Example
+	Env         []string   `yaml:"-"`
+	EnvFile     StringList `yaml:"env_file"`
+	EnvInherit  StringList `yaml:"env_inherit"`
+	Deps        []string
+	Params      []*Param
+	Flags       []*Flag
+	Sources     []string
+	Generates   []string
+	Method      string
+	Status      []*Runnable
+	Watch       []string
+	Before      []*Runnable
+	After       []*Runnable
+	OnSuccess   []*Runnable `yaml:"on_success"`
+	OnFailure   []*Runnable `yaml:"on_failure"`
+	Finally     []*Runnable
+
+	// ContinueOnError runs the task's command even when one of
+	// its before steps failed, which is the default.
+	ContinueOnError *bool `yaml:"continue_on_error"`
+
+	Timeout    time.Duration
+	Grace      time.Duration
+	Retries    int
+	RetryDelay time.Duration `yaml:"retry_delay"`
+	Backoff    float64
+	RetryOn    []int `yaml:"retry_on"`
+
+	// Stdout and Stderr receive the output of the task's
+	// runnables, they default to os.Stdout and os.Stderr.
+	Stdout io.Writer `yaml:"-"`
+	Stderr io.Writer `yaml:"-"`
+
+	// Force runs the task even when it is up to date.
+	Force bool `yaml:"-"`
+
+	// Verbose explains why the task is or isn't skipped.
+	Verbose bool `yaml:"-"`
+
+	// Spawn runs exec as a child process instead of replacing the
+	// current process, which is required when other tasks follow.
+	Spawn bool `yaml:"-"`
+
+	// GlobalEnv holds the variables of the global env files followed
+	// by the global env, the task's env files and env override them.
+	GlobalEnv []string `yaml:"-"`
+
+	// FileEnv holds the variables of the task's env files.
+	FileEnv []string `yaml:"-"`
+
+	// RunTask runs the tasks referenced by the task's steps.
+	RunTask RunTaskFunc `yaml:"-"`
+
+	// Vars holds the variables the task is interpolated with once its
+	// parameters and flags are known, it is nil for tasks without them.
+	Vars map[string]interface{} `yaml:"-"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler,
+// allowing env to be given as a list or a map.
+func (t *Task) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Task
+	var v struct {
+		plain `yaml:",inline"`
+		Env   EnvList
+	}
+
+	v.plain = plain(*t)
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+
+	*t = Task(v.plain)
+	t.Env = v.Env
+	return nil
 }
 
 // Run the task and its preceding and succeding steps with `args`.
 // - A failing before step will still allow the main task and the after steps to be executed
+// - A failing before step skips the main task instead when continue_on_error is false
 // - A failing task will always allow the after steps to be executed
+// - The on_failure hooks run when any of the above failed, the on_success hooks otherwise
+// - The finally hooks are always executed last
 func (t *Task) Run(args []string) []error {
+	return t.RunContext(context.Background(), args)
+}
+
+// RunContext runs the task like Run, the process groups of running
+// steps are killed when the context is cancelled.
+func (t *Task) RunContext(ctx context.Context, args []string) []error {
+	ctx = withTask(ctx, t.Name)
+	o := t.options(args)
+
 	var errs []error
-	if err := t.runTaskOptionals("before", t.Before, args); err != nil {
+	var beforeFailed bool
+	if err := runOptionals(ctx, "before", t.Name, t.Before, o); err != nil {
 		errs = append(errs, err)
+		beforeFailed = true
 	}
 
-	// wrap command, script, exec into a runnable
-	r := Runnable{Command: t.Command, Script: t.Script, Exec: t.Exec}
+	r := t.runnable()
 
-	if err := r.Run(t.LookupPath, args, t.Env); err != nil {
-		errs = append(errs, fmt.Errorf("task '%s' failed. Error: %+v", t.Name, err))
+	var upToDate bool
+	var reason string
+	var err error
+	if !t.Force && !beforeFailed {
+		upToDate, reason, err = t.upToDate(ctx, o)
 	}
 
-	if err := t.runTaskOptionals("after", t.After, args); err != nil {
+	switch {
+	case beforeFailed && t.ContinueOnError != nil && !*t.ContinueOnError:
+		fmt.Fprintf(o.Stderr, "task '%s' skipped, before step failed\n", t.Name)
+	case err != nil:
+		errs = append(errs, fmt.Errorf("task '%s' failed checking whether it is up to date. Error: %+v", t.Name, err))
+	case upToDate && t.Verbose:
+		fmt.Fprintf(o.Stderr, "task '%s' is up to date (%s)\n", t.Name, reason)
+	case upToDate:
+		fmt.Fprintf(o.Stderr, "task '%s' is up to date\n", t.Name)
+	case r.empty() && len(t.Deps) > 0:
+		// a task may consist of its dependencies only
+	default:
+		if t.Verbose && reason != "" {
+			fmt.Fprintf(o.Stderr, "task '%s' is not up to date (%s)\n", t.Name, reason)
+		}
+
+		if t.Verbose && t.Force {
+			fmt.Fprintf(o.Stderr, "task '%s' is forced to run\n", t.Name)
+		}
+
+		if err := r.run(ctx, o); err != nil {
+			errs = append(errs, &Error{Task: t.Name, Err: err})
+		} else if err := t.record(o); err != nil {
+			errs = append(errs, fmt.Errorf("task '%s' failed recording its sources. Error: %+v", t.Name, err))
+		}
+	}
+
+	if err := runOptionals(ctx, "after", t.Name, t.After, o); err != nil {
 		errs = append(errs, err)
 	}
 
-	return errs
+	var cause error
+	if len(errs) > 0 {
+		cause = Cause(t.Name, errs)
+	}
+
+	return append(errs, RunHooksContext(ctx, t.Name, t.OnSuccess, t.OnFailure, t.Finally, cause, o)...)
+}
+
+// Runnables returns the status steps, before and after steps and hooks of the task.
+func (t *Task) Runnables() []*Runnable {
+	var ret []*Runnable
+	for _, rs := range [][]*Runnable{t.Status, t.Before, t.After, t.OnSuccess, t.OnFailure, t.Finally} {
+		ret = append(ret, rs...)
+	}
+	return ret
+}
+
+// WorkDir returns the directory the task runs in, relative directories are
+// resolved against the lookup path. It is empty for the current directory.
+func (t *Task) WorkDir() string {
+	return ResolveDir(t.LookupPath, t.Dir)
+}
+
+// ResolveDir returns `dir` relative to `lookupPath` unless it is absolute or empty.
+func ResolveDir(lookupPath, dir string) string {
+	if dir == "" || filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(lookupPath, dir)
+}
+
+// runnable wraps the command, script or exec of the task into a runnable.
+func (t *Task) runnable() Runnable {
+	return Runnable{
+		Command:     t.Command,
+		Interpreter: t.Interpreter,
+		Script:      t.Script,
+		Exec:        t.Exec,
+		Timeout:     t.Timeout,
+		Grace:       t.Grace,
+		Retries:     t.Retries,
+		RetryDelay:  t.RetryDelay,
+		Backoff:     t.Backoff,
+		RetryOn:     t.RetryOn,
+	}
+}
+
+// Clone returns a copy of the task which can be
+// modified without affecting the original.
+func (t *Task) Clone() *Task {
+	c := *t
+	c.Env = append([]string(nil), t.Env...)
+	c.Status = cloneRunnables(t.Status)
+	c.Before = cloneRunnables(t.Before)
+	c.After = cloneRunnables(t.After)
+	c.OnSuccess = cloneRunnables(t.OnSuccess)
+	c.OnFailure = cloneRunnables(t.OnFailure)
+	c.Finally = cloneRunnables(t.Finally)
+
+	c.Examples = nil
+	for _, e := range t.Examples {
+		e := *e
+		c.Examples = append(c.Examples, &e)
+	}
+
+	return &c
+}
+
+func cloneRunnables(rs []*Runnable) []*Runnable {
+	var ret []*Runnable
+	for _, r := range rs {
+		r := *r
+		r.Args = append([]string(nil), r.Args...)
+		r.Env = append([]string(nil), r.Env...)
+		ret = append(ret, &r)
+	}
+	return ret
+}
+
+// options returns the options used to run the task's runnables.
+func (t *Task) options(args []string) Options {
+	o := Options{
+		LookupPath: t.LookupPath,
+		Args:       args,
+		Env:        append(append(append([]string(nil), t.GlobalEnv...), t.FileEnv...), t.Env...),
+		Dir:        t.WorkDir(),
+		Shell:      t.Shell,
+		Inherit:    t.EnvInherit,
+		Stdin:      os.Stdin,
+		Stdout:     t.Stdout,
+		Stderr:     t.Stderr,
+		Grace:      t.Grace,
+		Spawn:      t.Spawn,
+		RunTask:    t.RunTask,
+	}
+
+	if o.Stdout == nil {
+		o.Stdout = os.Stdout
+	}
+
+	if o.Stderr == nil {
+		o.Stderr = os.Stderr
+	}
+
+	return o
 }
 
-func (t *Task) runTaskOptionals(id string, rs []*Runnable, args []string) error {
-	return RunOptionals(id, t.Name, rs, args, t.LookupPath, t.Env)
+// DefaultShell runs commands unless a shell is configured.
+var DefaultShell = "sh -c"
+
+// DefaultGrace is the time a cancelled process is given
+// to exit after SIGTERM before it is killed.
+var DefaultGrace = 5 * time.Second
+
+// Options describes how a runnable is invoked.
+type Options struct {
+	// LookupPath is the directory relative scripts are looked up in.
+	LookupPath string
+
+	// Args are passed to the command, script or exec.
+	Args []string
+
+	// Env is added to the inherited environment of the current
+	// process, later variables override earlier ones.
+	Env []string
+
+	// Inherit holds the patterns of the inherited variables, see Inherited.
+	Inherit []string
+
+	// Dir is the working directory, the current one when empty.
+	Dir string
+
+	// Shell runs commands followed by their arguments, DefaultShell when empty.
+	Shell string
+
+	// Stdin, Stdout and Stderr are connected to the process,
+	// the null device is used when nil.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Grace is the time given to the process to exit after
+	// cancellation before it is killed, DefaultGrace when zero.
+	Grace time.Duration
+
+	// Spawn runs exec as a child process instead of replacing the current process.
+	Spawn bool
+
+	// RunTask runs the tasks referenced by runnables,
+	// which fail when it is nil.
+	RunTask RunTaskFunc
+}
+
+// defaultOptions returns options connected to the process's stdio.
+func defaultOptions(lookupPath string, args []string, env []string) Options {
+	return Options{
+		LookupPath: lookupPath,
+		Args:       args,
+		Env:        env,
+		Stdin:      os.Stdin,
+		Stdout:     os.Stdout,
+		Stderr:     os.Stderr,
+	}
 }
 
 // Runnable describes an 'executable' element defined in the overall robo configuration.
 // A valid Runnable is one of: command, script or exec.
 //
-// - command is a shell script provided as an optional multilined string.
+// - command is a shell script provided as an optional multilined string,
+// which is run by the given interpreter instead of the shell when set.
 // - script holds the path to a script passing the given arguments straight
 // - exec describes a binary which will be looked up for execution
+// - task references another task which is run with the given args
+//
+// A Runnable running longer than its timeout is terminated like a cancelled one,
+// its grace period takes precedence over the one of the options. A failing
+// Runnable is attempted again up to `retries` times. The failure of a Runnable
+// with `ignore_error` doesn't fail the task and allows the following steps to run.
+// Its dir, relative to the lookup path, takes precedence over the one of the options
+// and its env is added to the one of the options.
 type Runnable struct {
-	Command string
-	Script  string
-	Exec    string
+	Command     string
+	Interpreter string
+	Script      string
+	Exec        string
+	Task        string
+	Args        []string
+	Dir         string
+	Timeout     time.Duration
+	Grace       time.Duration
+	Retries     int
+	RetryDelay  time.Duration `yaml:"retry_delay"`
+	Backoff     float64
+	RetryOn     []int    `yaml:"retry_on"`
+	IgnoreError bool     `yaml:"ignore_error"`
+	Env         []string `yaml:"-"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler,
+// allowing env to be given as a list or a map.
+func (r *Runnable) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Runnable
+	var v struct {
+		plain `yaml:",inline"`
+		Env   EnvList
+	}
+
+	v.plain = plain(*r)
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+
+	*r = Runnable(v.plain)
+	r.Env = v.Env
+	return nil
+}
+
+// empty returns true when there is nothing to run.
+func (r *Runnable) empty() bool {
+	return r.Command == "" && r.Script == "" && r.Exec == "" && r.Task == ""
+}
+
+// check makes sure the runnable is valid.
+func (r *Runnable) check() error {
+	if r.Interpreter != "" && r.Command == "" {
+		return fmt.Errorf("interpreter requires a command")
+	}
+
+	if r.Task != "" && (r.Command != "" || r.Script != "" || r.Exec != "") {
+		return fmt.Errorf("task %q can't be combined with command, script or exec", r.Task)
+	}
+
+	if len(r.Args) > 0 && r.Task == "" {
+		return fmt.Errorf("args require a task")
+	}
+
+	if r.Timeout < 0 || r.Grace < 0 {
+		return fmt.Errorf("timeout and grace must not be negative")
+	}
+
+	if r.Retries < 0 || r.RetryDelay < 0 || r.Backoff < 0 {
+		return fmt.Errorf("retries, retry_delay and backoff must not be negative")
+	}
+
+	if len(r.RetryOn) > 0 && r.Retries == 0 {
+		return fmt.Errorf("retry_on requires retries")
+	}
+
+	return nil
 }
 
 // Run invokes the Runnable according to its definition.
 // An invalid (empty) Runnable will result in an error.
 func (r *Runnable) Run(lookupPath string, args []string, env []string) error {
+	return r.run(context.Background(), defaultOptions(lookupPath, args, env))
+}
+
+// RunContext invokes the Runnable like Run with the given options. An exec
+// runs as a child process instead of replacing the current process. When
+// the context is cancelled the process group of the child receives SIGTERM,
+// followed by SIGKILL once the grace period is over.
+func (r *Runnable) RunContext(ctx context.Context, o Options) error {
+	if r.Grace != 0 {
+		o.Grace = r.Grace
+	}
+
+	if r.Dir != "" {
+		o.Dir = ResolveDir(o.LookupPath, r.Dir)
+	}
+
+	if len(r.Env) > 0 {
+		o.Env = append(append([]string(nil), o.Env...), r.Env...)
+	}
+
+	if r.Retries > 0 {
+		return r.retry(ctx, o)
+	}
+
+	return r.attempt(ctx, o)
+}
+
+// attempt runs the runnable once within its timeout.
+func (r *Runnable) attempt(ctx context.Context, o Options) error {
+	if r.Timeout == 0 {
+		return r.start(ctx, o)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	err := r.start(tctx, o)
+	if err == context.DeadlineExceeded && ctx.Err() == nil {
+		return &timeoutError{r.Timeout}
+	}
+	return err
+}
+
+// start runs the command, script or exec of the runnable.
+func (r *Runnable) start(ctx context.Context, o Options) error {
+	if r.Task != "" {
+		return r.runTask(ctx, o)
+	}
+
 	if r.Exec != "" {
-		return r.RunExec(args, env)
+		return r.RunExecContext(ctx, o)
 	}
 
 	if r.Script != "" {
-		return r.RunScript(lookupPath, args, env)
+		return r.RunScriptContext(ctx, o)
 	}
 
 	if r.Command != "" {
-		return r.RunCommand(args, env)
+		return r.RunCommandContext(ctx, o)
+	}
+
+	return fmt.Errorf("nothing to run (add script, command, exec or task key)")
+}
+
+func (r *Runnable) run(ctx context.Context, o Options) error {
+	// the process image can only be replaced when the output isn't
+	// redirected, there is nothing to cancel and nothing runs after it.
+	if r.Exec != "" && !o.Spawn && o.Stdout == os.Stdout && o.Stderr == os.Stderr && o.Dir == "" && r.Dir == "" && ctx.Done() == nil && r.Timeout == 0 && r.Retries == 0 {
+		return r.replace(o.Args, merge(Inherited(o.Inherit), append(append([]string(nil), o.Env...), r.Env...)))
 	}
 
-	return fmt.Errorf("nothing to run (add script, command, or exec key)")
+	return r.RunContext(ctx, o)
 }
 
-func (r *Runnable) runInternal(cmd *exec.Cmd) error {
+func (r *Runnable) runInternal(ctx context.Context, cmd *exec.Cmd, o Options) error {
+	cmd.Dir = o.Dir
+	cmd.Env = merge(Inherited(o.Inherit), o.Env)
+	cmd.Stdin = o.Stdin
+	cmd.Stdout = o.Stdout
+	cmd.Stderr = o.Stderr
+
+	if ctx.Done() == nil {
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		// The child process receives SIGINT from the terminal and
+		// aborts normally, then we will continue.
+		track(cmd.Process.Pid, false)
+		defer untrack(cmd.Process.Pid)
+		return cmd.Wait()
+	}
+
+	// Cancellable commands run in their own process group, which allows
+	// terminating the command along with its children. The group doesn't
+	// receive the signals of the terminal, which are forwarded instead,
+	// and can't read from it.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if isTerminal(o.Stdin) {
+		cmd.Stdin = nil
+	}
+
 	if err := cmd.Start(); err != nil {
 		return err
 	}
-	// Ignore SIGINT while waiting for a child process. The child process will
-	// receive the signal and abort normally, then we will continue.
-	signal.Ignore(os.Interrupt);
-	defer signal.Reset(os.Interrupt);
-	return cmd.Wait();
+	track(cmd.Process.Pid, true)
+	defer untrack(cmd.Process.Pid)
+
+	grace := o.Grace
+	if grace == 0 {
+		grace = DefaultGrace
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+
+	err := cmd.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// isTerminal returns true when `r` is a terminal, or another character device.
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// children holds the running child processes by pid, and whether they run
+// in their own process group. While any of them runs SIGINT and SIGTERM
+// are caught and forwarded to them, so that they exit before we do.
+var children struct {
+	sync.Mutex
+	pids    map[int]bool
+	signals chan os.Signal
+}
+
+// track forwards signals to the child process `pid` until untrack is called.
+// Only process groups receive SIGINT, other children already receive the one
+// of the terminal.
+func track(pid int, group bool) {
+	children.Lock()
+	defer children.Unlock()
+
+	if children.signals == nil {
+		children.signals = make(chan os.Signal, 1)
+		go forward(children.signals)
+	}
+
+	if len(children.pids) == 0 {
+		children.pids = make(map[int]bool)
+		signal.Notify(children.signals, os.Interrupt, syscall.SIGTERM)
+	}
+	children.pids[pid] = group
+}
+
+// untrack stops forwarding signals to the child process `pid`, the
+// signals are handled as usual once no child process is running.
+func untrack(pid int) {
+	children.Lock()
+	defer children.Unlock()
+
+	delete(children.pids, pid)
+	if len(children.pids) == 0 {
+		signal.Stop(children.signals)
+	}
+}
+
+// forward the `signals` to the tracked child processes.
+func forward(signals <-chan os.Signal) {
+	for sig := range signals {
+		children.Lock()
+		for pid, group := range children.pids {
+			switch {
+			case group:
+				syscall.Kill(-pid, sig.(syscall.Signal))
+			case sig == syscall.SIGTERM:
+				syscall.Kill(pid, syscall.SIGTERM)
+			}
+		}
+		children.Unlock()
+	}
 }
 
 // RunScript runs the target shell `script` file.
 func (r *Runnable) RunScript(lookupPath string, args []string, env []string) error {
+	return r.RunScriptContext(context.Background(), defaultOptions(lookupPath, args, env))
+}
+
+// RunScriptContext runs the target shell `script` file with the given options.
+func (r *Runnable) RunScriptContext(ctx context.Context, o Options) error {
+	var args = o.Args
 	var path = r.Script
 	var bin = path
 
 	if !strings.HasPrefix(path, "/") {
-		path = filepath.Join(lookupPath, r.Script)
+		path = filepath.Join(o.LookupPath, r.Script)
 		bin = path
 	}
 
@@ -122,26 +666,79 @@ func (r *Runnable) RunScript(lookupPath string, args []string, env []string) err
 	}
 
 	cmd := exec.Command(bin, args...)
-	cmd.Env = append(os.Environ(), env...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return r.runInternal(cmd)
+	return r.runInternal(ctx, cmd, o)
 }
 
 // RunCommand runs the `command` via the shell.
 func (r *Runnable) RunCommand(args []string, env []string) error {
-	args = append([]string{"-c", r.Command, "sh"}, args...)
-	cmd := exec.Command("sh", args...)
-	cmd.Env = append(os.Environ(), env...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return r.runInternal(cmd)
+	return r.RunCommandContext(context.Background(), defaultOptions("", args, env))
 }
 
-// RunExec runs the `exec` command.
+// RunCommandContext runs the `command` via the shell with the given options,
+// or via the interpreter which is passed a file containing the command.
+func (r *Runnable) RunCommandContext(ctx context.Context, o Options) error {
+	if r.Interpreter != "" {
+		return r.runInterpreter(ctx, o)
+	}
+
+	shell := o.Shell
+	if shell == "" {
+		shell = DefaultShell
+	}
+
+	fields, err := shellwords.Parse(shell)
+	if err != nil {
+		return err
+	}
+
+	if len(fields) == 0 {
+		return fmt.Errorf("empty shell")
+	}
+
+	// the shell itself is passed as $0 of the command.
+	args := append(append(fields[1:], r.Command, fields[0]), o.Args...)
+	cmd := exec.Command(fields[0], args...)
+	return r.runInternal(ctx, cmd, o)
+}
+
+// runInterpreter writes the `command` to a temporary file run by the interpreter.
+func (r *Runnable) runInterpreter(ctx context.Context, o Options) error {
+	fields, err := shellwords.Parse(r.Interpreter)
+	if err != nil {
+		return err
+	}
+
+	if len(fields) == 0 {
+		return fmt.Errorf("empty interpreter")
+	}
+
+	f, err := ioutil.TempFile("", "robo-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(r.Command); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	args := append(append(fields[1:], f.Name()), o.Args...)
+	cmd := exec.Command(fields[0], args...)
+	return r.runInternal(ctx, cmd, o)
+}
+
+// RunExec runs the `exec` command, replacing the current process.
 func (r *Runnable) RunExec(args []string, env []string) error {
+	return r.replace(args, merge(os.Environ(), env))
+}
+
+// replace replaces the current process with the `exec` command and the environment `envs`.
+func (r *Runnable) replace(args []string, envs []string) error {
 	fields, err := shellwords.Parse(r.Exec)
 	if err != nil {
 		return err
@@ -153,11 +750,25 @@ func (r *Runnable) RunExec(args []string, env []string) error {
 		return err
 	}
 
-	envs := merge(os.Environ(), env)
 	args = append(fields, args...)
 	return syscall.Exec(path, args, envs)
 }
 
+// RunExecContext runs the `exec` command as a child process with the given options.
+func (r *Runnable) RunExecContext(ctx context.Context, o Options) error {
+	fields, err := shellwords.Parse(r.Exec)
+	if err != nil {
+		return err
+	}
+
+	if len(fields) == 0 {
+		return fmt.Errorf("empty exec")
+	}
+
+	cmd := exec.Command(fields[0], append(fields[1:], o.Args...)...)
+	return r.runInternal(ctx, cmd, o)
+}
+
 // Merge merges the given two lists of env vars.
 func merge(a, b []string) []string {
 	var items = make(map[string]string)
@@ -184,11 +795,29 @@ func merge(a, b []string) []string {
 	return ret
 }
 
+// RunOptionalsContext runs the runnables like RunOptionals with the given options,
+// the running step is terminated when the context is cancelled.
+func RunOptionalsContext(ctx context.Context, id string, parent string, rs []*Runnable, o Options) error {
+	return runOptionals(ctx, id, parent, rs, o)
+}
+
 // RunOptionals executes a list of runnables and immediately returns an error if one of them an error not executing the remaining ones.
+// Errors of runnables with `ignore_error` are logged and the remaining runnables are executed.
 func RunOptionals(id string, parent string, rs []*Runnable, args []string, lookupPath string, envs []string) error {
+	return runOptionals(context.Background(), id, parent, rs, defaultOptions(lookupPath, args, envs))
+}
+
+func runOptionals(ctx context.Context, id string, parent string, rs []*Runnable, o Options) error {
 	for i, r := range rs {
-		if err := r.Run(lookupPath, args, envs); err != nil {
-			return fmt.Errorf("%s step #%d of task '%s' failed. Error: %+v", id, i+1, parent, err)
+		if err := r.run(ctx, o); err != nil {
+			err := &Error{Task: parent, Step: id, Index: i + 1, Err: err}
+			if !r.IgnoreError || ctx.Err() != nil {
+				return err
+			}
+
+			if o.Stderr != nil {
+				fmt.Fprintf(o.Stderr, "%s (ignored)\n", err)
+			}
 		}
 	}
 	return nil
@@ -0,0 +1,191 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestRunnable_RunContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "robo")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	var stdout, stderr bytes.Buffer
+	r := &Runnable{Command: `read line; echo "$line $1 $FOO $(pwd)"; echo oops >&2`}
+	err = r.RunContext(context.Background(), Options{
+		Args:   []string{"arg"},
+		Env:    []string{"FOO=bar"},
+		Dir:    dir,
+		Stdin:  strings.NewReader("input\n"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	assert.Equal(t, nil, err)
+
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	pwd, _ := os.Getwd()
+	os.Chdir(wd)
+
+	assert.Equal(t, "input arg bar "+pwd+"\n", stdout.String())
+	assert.Equal(t, "oops\n", stderr.String())
+}
+
+func TestRunnable_RunContext_exec(t *testing.T) {
+	var stdout bytes.Buffer
+	r := &Runnable{Exec: "echo hello"}
+	err := r.RunContext(context.Background(), Options{Args: []string{"world"}, Stdout: &stdout})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "hello world\n", stdout.String())
+}
+
+func TestRunnable_RunContext_cancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	r := &Runnable{Command: "sleep 10"}
+	err := r.RunContext(ctx, Options{})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.T(t, time.Since(start) < 5*time.Second)
+}
+
+func TestRunnable_RunContext_grace(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// the command ignores SIGTERM and is killed after the grace period.
+	start := time.Now()
+	r := &Runnable{Command: "trap '' TERM; sleep 10"}
+	err := r.RunContext(ctx, Options{Grace: 200 * time.Millisecond})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.T(t, time.Since(start) >= 300*time.Millisecond)
+	assert.T(t, time.Since(start) < 5*time.Second)
+}
+
+func TestRunnable_RunContext_timeout(t *testing.T) {
+	r := &Runnable{Command: "sleep 10", Timeout: 100 * time.Millisecond}
+	err := r.RunContext(context.Background(), Options{})
+	assert.Equal(t, "timed out after 100ms", err.Error())
+}
+
+func TestRunnable_RunContext_interrupt(t *testing.T) {
+	time.AfterFunc(200*time.Millisecond, func() {
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+	})
+
+	// the output is only closed once the nested shell exited as well.
+	var stdout bytes.Buffer
+	start := time.Now()
+	r := &Runnable{Command: "sh -c 'sleep 37'; echo done", Timeout: time.Minute}
+	err := r.RunContext(context.Background(), Options{Stdout: &stdout})
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, "", stdout.String())
+	assert.T(t, time.Since(start) < 5*time.Second)
+}
+
+func TestTask_Run_timeout(t *testing.T) {
+	tk := &Task{
+		Name:    "hang",
+		Command: "sleep 10",
+		Timeout: 100 * time.Millisecond,
+		After:   []*Runnable{{Command: "sleep 10", Timeout: 100 * time.Millisecond, Grace: time.Second}},
+		Stdout:  ioutil.Discard,
+		Stderr:  ioutil.Discard,
+	}
+
+	errs := tk.Run(nil)
+	assert.Equal(t, 2, len(errs))
+	assert.Equal(t, "task 'hang' failed. Error: timed out after 100ms", errs[0].Error())
+	assert.Equal(t, "after step #1 of task 'hang' failed. Error: timed out after 100ms", errs[1].Error())
+}
+
+func TestTask_Run_ignoreError(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	tk := &Task{
+		Name:    "setup",
+		Command: "echo main",
+		Before:  []*Runnable{{Command: "exit 1", IgnoreError: true}, {Command: "echo before"}},
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+	}
+
+	errs := tk.Run(nil)
+	assert.Equal(t, 0, len(errs))
+	assert.Equal(t, "before\nmain\n", stdout.String())
+	assert.Equal(t, "before step #1 of task 'setup' failed. Error: exit status 1 (ignored)\n", stderr.String())
+}
+
+func TestTask_Run_continueOnError(t *testing.T) {
+	var stdout bytes.Buffer
+	tk := &Task{
+		Name:    "setup",
+		Command: "echo main",
+		Before:  []*Runnable{{Command: "exit 1"}, {Command: "echo before"}},
+		After:   []*Runnable{{Command: "echo after"}},
+		Stdout:  &stdout,
+		Stderr:  ioutil.Discard,
+	}
+
+	errs := tk.Run(nil)
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, "main\nafter\n", stdout.String())
+
+	stdout.Reset()
+	stop := false
+	tk.ContinueOnError = &stop
+	errs = tk.Run(nil)
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, "after\n", stdout.String())
+}
+
+func TestTask_WorkDir(t *testing.T) {
+	tk := &Task{LookupPath: "/project"}
+	assert.Equal(t, "", tk.WorkDir())
+
+	tk.Dir = "web"
+	assert.Equal(t, "/project/web", tk.WorkDir())
+
+	tk.Dir = "/tmp"
+	assert.Equal(t, "/tmp", tk.WorkDir())
+}
+
+func TestRunnable_RunContext_dir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "robo")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "web"), 0755)
+	assert.Equal(t, nil, err)
+
+	var stdout bytes.Buffer
+	r := &Runnable{Command: "basename $(pwd)", Dir: "web"}
+	err = r.RunContext(context.Background(), Options{LookupPath: dir, Dir: os.TempDir(), Stdout: &stdout})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "web\n", stdout.String())
+}
+
+func TestRunnable_RunContext_shell(t *testing.T) {
+	var stdout bytes.Buffer
+	r := &Runnable{Command: `echo "$0 $1"; false | true`}
+	err := r.RunContext(context.Background(), Options{Shell: "bash -o pipefail -c", Args: []string{"arg"}, Stdout: &stdout})
+	assert.Equal(t, "exit status 1", err.Error())
+	assert.Equal(t, "bash arg\n", stdout.String())
+}
+
+func TestRunnable_RunContext_interpreter(t *testing.T) {
+	var stdout bytes.Buffer
+	r := &Runnable{Command: "echo \"$1\"\necho done", Interpreter: "sh -e"}
+	err := r.RunContext(context.Background(), Options{Args: []string{"arg"}, Stdout: &stdout})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "arg\ndone\n", stdout.String())
+}
@@ -0,0 +1,69 @@
+package task
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// watchPatterns returns the patterns of the files watched,
+// which default to the task's sources.
+func (t *Task) watchPatterns() []string {
+	if len(t.Watch) > 0 {
+		return t.Watch
+	}
+	return t.Sources
+}
+
+// Watchable returns true when the task has files to watch.
+func (t *Task) Watchable() bool {
+	return len(t.watchPatterns()) > 0
+}
+
+// Watches returns true when a change to the file at `path` should
+// restart the task. Patterns prefixed with "!" ignore matching files,
+// the last matching pattern wins.
+func (t *Task) Watches(path string) bool {
+	watched := false
+
+	for _, pattern := range t.watchPatterns() {
+		ignore := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(t.LookupPath, pattern)
+		}
+
+		if match(split(pattern), split(path)) {
+			watched = !ignore
+		}
+	}
+
+	return watched
+}
+
+// Skips returns true when the directory `dir` does not need to be
+// watched, which is the case for version control and robo's state
+// directories, and directories whose content is ignored.
+func (t *Task) Skips(dir string) bool {
+	switch filepath.Base(dir) {
+	case ".git", ".hg", ".svn", StateDir:
+		return true
+	}
+
+	for _, pattern := range t.watchPatterns() {
+		if !strings.HasPrefix(pattern, "!") || !strings.HasSuffix(pattern, "/**") {
+			continue
+		}
+
+		pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "!"), "/**")
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(t.LookupPath, pattern)
+		}
+
+		if match(split(pattern), split(dir)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,27 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestWatches(t *testing.T) {
+	tk := &Task{
+		LookupPath: "/app",
+		Watch:      []string{"**/*.go", "!vendor/**", "!**/*_test.go"},
+	}
+
+	assert.Equal(t, true, tk.Watchable())
+	assert.Equal(t, true, tk.Watches("/app/main.go"))
+	assert.Equal(t, true, tk.Watches("/app/cmd/app/main.go"))
+	assert.Equal(t, false, tk.Watches("/app/main_test.go"))
+	assert.Equal(t, false, tk.Watches("/app/vendor/lib/lib.go"))
+	assert.Equal(t, false, tk.Watches("/app/Readme.md"))
+
+	assert.Equal(t, true, tk.Skips("/app/vendor"))
+	assert.Equal(t, true, tk.Skips("/app/.git"))
+	assert.Equal(t, false, tk.Skips("/app/cmd"))
+
+	assert.Equal(t, false, (&Task{}).Watchable())
+}
@@ -0,0 +1,28 @@
+// Package watch reports changes to the files below a directory.
+package watch
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// walk calls fn for `root` and each of its subdirectories,
+// except for the ones `skip` returns true for.
+func walk(root string, skip func(dir string) bool, fn func(dir string) error) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// files may vanish while walking
+			return nil
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		if path != root && skip != nil && skip(path) {
+			return filepath.SkipDir
+		}
+
+		return fn(path)
+	})
+}
@@ -0,0 +1,127 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// Events watched for.
+const mask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// Watcher reports the files changed below a directory using inotify.
+type Watcher struct {
+	// Events receives the paths of changed files.
+	Events chan string
+
+	// Errors receives errors reading events.
+	Errors chan error
+
+	file *os.File
+	fd   int
+	skip func(string) bool
+	mu   sync.Mutex
+	dirs map[int]string
+	done chan struct{}
+}
+
+// New watches the directory `root` and its subdirectories, except
+// for the directories `skip` returns true for. New directories are
+// watched as they are created.
+func New(root string, skip func(dir string) bool) (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		Events: make(chan string),
+		Errors: make(chan error),
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		fd:     fd,
+		skip:   skip,
+		dirs:   make(map[int]string),
+		done:   make(chan struct{}),
+	}
+
+	if err := w.add(root); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+
+	go w.read()
+	return w, nil
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	close(w.done)
+	return w.file.Close()
+}
+
+// add watches `root` and its subdirectories.
+func (w *Watcher) add(root string) error {
+	return walk(root, w.skip, func(dir string) error {
+		wd, err := syscall.InotifyAddWatch(w.fd, dir, mask)
+		if err != nil {
+			return err
+		}
+
+		w.mu.Lock()
+		w.dirs[wd] = dir
+		w.mu.Unlock()
+		return nil
+	})
+}
+
+// read reads inotify events until the watcher is closed.
+func (w *Watcher) read() {
+	buf := make([]byte, 4096*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			select {
+			case <-w.done:
+			case w.Errors <- err:
+			}
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			name := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+			off += syscall.SizeofInotifyEvent + int(ev.Len)
+
+			w.mu.Lock()
+			dir := w.dirs[int(ev.Wd)]
+			if ev.Mask&syscall.IN_IGNORED != 0 {
+				delete(w.dirs, int(ev.Wd))
+			}
+			w.mu.Unlock()
+
+			if dir == "" || ev.Mask&syscall.IN_IGNORED != 0 {
+				continue
+			}
+
+			path := filepath.Join(dir, strings.TrimRight(string(name), "\x00"))
+
+			if ev.Mask&syscall.IN_ISDIR != 0 {
+				if ev.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 && (w.skip == nil || !w.skip(path)) {
+					w.add(path)
+				}
+				continue
+			}
+
+			select {
+			case w.Events <- path:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+//go:build !linux
+// +build !linux
+
+package watch
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+// Interval is the interval at which files are polled.
+var Interval = 500 * time.Millisecond
+
+// Watcher reports the files changed below a directory by polling
+// their modification time.
+type Watcher struct {
+	// Events receives the paths of changed files.
+	Events chan string
+
+	// Errors receives errors reading events.
+	Errors chan error
+
+	root string
+	skip func(string) bool
+	done chan struct{}
+}
+
+// New watches the directory `root` and its subdirectories, except
+// for the directories `skip` returns true for.
+func New(root string, skip func(dir string) bool) (*Watcher, error) {
+	w := &Watcher{
+		Events: make(chan string),
+		Errors: make(chan error),
+		root:   root,
+		skip:   skip,
+		done:   make(chan struct{}),
+	}
+
+	files, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	go w.poll(files)
+	return w, nil
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	close(w.done)
+	return nil
+}
+
+// scan returns the modification times of the watched files.
+func (w *Watcher) scan() (map[string]time.Time, error) {
+	files := make(map[string]time.Time)
+
+	err := walk(w.root, w.skip, func(dir string) error {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil
+		}
+
+		for _, info := range infos {
+			if !info.IsDir() {
+				files[filepath.Join(dir, info.Name())] = info.ModTime()
+			}
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// poll compares the watched files with `prev` until the watcher is closed.
+func (w *Watcher) poll(prev map[string]time.Time) {
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-time.After(Interval):
+		}
+
+		files, err := w.scan()
+		if err != nil {
+			select {
+			case w.Errors <- err:
+			case <-w.done:
+			}
+			return
+		}
+
+		var changed []string
+		for path, mtime := range files {
+			if t, ok := prev[path]; !ok || !t.Equal(mtime) {
+				changed = append(changed, path)
+			}
+		}
+
+		for path := range prev {
+			if _, ok := files[path]; !ok {
+				changed = append(changed, path)
+			}
+		}
+
+		for _, path := range changed {
+			select {
+			case w.Events <- path:
+			case <-w.done:
+				return
+			}
+		}
+
+		prev = files
+	}
+}
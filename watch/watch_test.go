@@ -0,0 +1,37 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	assert.Equal(t, nil, os.Mkdir(filepath.Join(dir, "skipped"), 0755))
+
+	w, err := New(dir, func(dir string) bool {
+		return filepath.Base(dir) == "skipped"
+	})
+	assert.Equal(t, nil, err)
+	defer w.Close()
+
+	assert.Equal(t, nil, ioutil.WriteFile(filepath.Join(dir, "skipped", "file"), nil, 0644))
+	assert.Equal(t, nil, ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0644))
+
+	select {
+	case path := <-w.Events:
+		assert.Equal(t, filepath.Join(dir, "file"), path)
+	case err := <-w.Errors:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+}